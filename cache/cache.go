@@ -0,0 +1,127 @@
+// cache.go - local store of validators and bodies of fetched URLs, for conditional requests.
+
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/NKztq/spider/canonicalizer"
+)
+
+// Entry is what is stored for a URL.
+type Entry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"` // raw Last-Modified header
+	ContentType  string `json:"content_type,omitempty"`
+	Charset      string `json:"charset,omitempty"`
+	Transcoded   bool   `json:"transcoded,omitempty"`
+
+	Body []byte `json:"-"`
+}
+
+// Cache stores every entry in a file named by hash of canonical URL,
+// file content is entry in JSON, a newline, and body.
+type Cache struct {
+	directory     string
+	canonicalizer *canonicalizer.Canonicalizer // entries of equivalent URLs are shared
+}
+
+// Open cache in directory, entries saved by last run are kept.
+func Open(directory string, canonicalizer *canonicalizer.Canonicalizer) (*Cache, error) {
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("directory: %s, os.MkdirAll(): %v", directory, err)
+	}
+
+	return &Cache{directory, canonicalizer}, nil
+}
+
+// Get entry of rawURL, returns nil if absent.
+func (c *Cache) Get(rawURL string) (*Entry, error) {
+	fp, err := c.filePath(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(fp)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile(): %v", err)
+	}
+
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return nil, fmt.Errorf("file: %s, broken entry", fp)
+	}
+
+	var e Entry
+	if err := json.Unmarshal(data[:i], &e); err != nil {
+		return nil, fmt.Errorf("file: %s, json.Unmarshal(): %v", fp, err)
+	}
+	e.Body = data[i+1:]
+
+	return &e, nil
+}
+
+// Put entry of rawURL, replaces the old one atomically.
+func (c *Cache) Put(rawURL string, e *Entry) error {
+	fp, err := c.filePath(rawURL)
+	if err != nil {
+		return err
+	}
+
+	header, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("json.Marshal(): %v", err)
+	}
+
+	tmp, err := ioutil.TempFile(c.directory, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("ioutil.TempFile(): %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	w.Write(header)
+	w.WriteByte('\n')
+	w.Write(e.Body)
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("file: %s, write failed: %v", tmp.Name(), err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("file: %s, close failed: %v", tmp.Name(), err)
+	}
+
+	if err := os.Rename(tmp.Name(), fp); err != nil {
+		return fmt.Errorf("os.Rename(): %v", err)
+	}
+
+	return nil
+}
+
+// Get path of file storing entry of rawURL.
+func (c *Cache) filePath(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("url.Parse(): %v", err)
+	}
+
+	key := c.canonicalizer.Canonicalize(u).String()
+	sum := sha1.Sum([]byte(key))
+
+	return path.Join(c.directory, hex.EncodeToString(sum[:])), nil
+}
@@ -0,0 +1,90 @@
+// cache_test.go - UT for cache.go.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/canonicalizer"
+)
+
+func openTestCache(t *testing.T) (*Cache, string) {
+	directory, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+
+	c, err := Open(directory, canonicalizer.NewCanonicalizer(true, []string{"utm_*"}))
+	assert.NoError(t, err)
+
+	return c, directory
+}
+
+func TestCache(t *testing.T) {
+	c, directory := openTestCache(t)
+	defer os.RemoveAll(directory)
+
+	// absent
+	e, err := c.Get("http://www.baidu.com/")
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+
+	entry := &Entry{
+		URL:          "http://www.baidu.com/?b=2&a=1",
+		ETag:         `"v1"`,
+		LastModified: "Mon, 02 Mar 2020 08:00:00 GMT",
+		ContentType:  "text/html",
+		Charset:      "gbk",
+		Transcoded:   true,
+		Body:         []byte("line1\nline2\n"),
+	}
+	assert.NoError(t, c.Put(entry.URL, entry))
+
+	// equivalent URL shares the entry
+	e, err = c.Get("HTTP://www.baidu.com:80/?a=1&b=2&utm_source=x#top")
+	assert.NoError(t, err)
+	assert.Equal(t, entry, e)
+
+	// replaced
+	entry.ETag = `"v2"`
+	entry.Body = []byte{}
+	assert.NoError(t, c.Put(entry.URL, entry))
+
+	e, err = c.Get(entry.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, entry, e)
+
+	// no temp file left
+	files, err := ioutil.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+}
+
+func TestCache_Reopen(t *testing.T) {
+	c, directory := openTestCache(t)
+	defer os.RemoveAll(directory)
+
+	entry := &Entry{URL: "http://www.baidu.com/", ETag: `"v1"`, Body: []byte("test")}
+	assert.NoError(t, c.Put(entry.URL, entry))
+
+	c, err := Open(directory, canonicalizer.NewCanonicalizer(true, nil))
+	assert.NoError(t, err)
+
+	e, err := c.Get(entry.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, entry, e)
+}
+
+func TestCache_Broken(t *testing.T) {
+	c, directory := openTestCache(t)
+	defer os.RemoveAll(directory)
+
+	fp, err := c.filePath("http://www.baidu.com/")
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(fp, []byte("broken"), 0644))
+
+	_, err = c.Get("http://www.baidu.com/")
+	assert.Error(t, err)
+}
@@ -0,0 +1,175 @@
+// canonicalizer.go - canonicalize URLs, so that equivalent URLs are deduplicated.
+
+package canonicalizer
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// default ports of schemes, stripped from host
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+type Canonicalizer struct {
+	sortQuery  bool     // sort query params by key
+	dropParams []string // glob patterns of query params to drop, like "utm_*"
+}
+
+func NewCanonicalizer(sortQuery bool, dropParams []string) *Canonicalizer {
+	return &Canonicalizer{sortQuery, dropParams}
+}
+
+// Canonicalize gets canonical form of u, u itself is not modified.
+//
+// Canonical form has:
+//   - lower-cased scheme and host, without default port.
+//   - no fragment.
+//   - path without dot segments, "/" if empty.
+//   - query without dropped params, sorted if sortQuery is set.
+func (c *Canonicalizer) Canonicalize(u *url.URL) *url.URL {
+	cu := *u
+
+	cu.Scheme = strings.ToLower(cu.Scheme)
+	cu.Host = canonicalHost(cu.Scheme, cu.Host)
+
+	cu.Fragment = ""
+
+	if cu.Opaque == "" {
+		p := removeDotSegments(cu.EscapedPath())
+		if p == "" && cu.Host != "" {
+			p = "/"
+		}
+
+		unescaped, err := url.PathUnescape(p)
+		if err == nil {
+			cu.Path = unescaped
+			cu.RawPath = p
+		}
+	}
+
+	cu.RawQuery = c.canonicalQuery(cu.RawQuery)
+	cu.ForceQuery = false
+
+	return &cu
+}
+
+// Host gets canonical host of u, lower-cased and without default port of its scheme,
+// like "www.baidu.com" of "http://WWW.Baidu.com:80/".
+func Host(u *url.URL) string {
+	return canonicalHost(strings.ToLower(u.Scheme), u.Host)
+}
+
+// Lower-case host and strip default port of scheme.
+func canonicalHost(scheme, host string) string {
+	host = strings.ToLower(host)
+
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		// no port
+		return host
+	}
+
+	if port == "" || port == defaultPorts[scheme] {
+		if strings.Contains(hostname, ":") {
+			// IPv6
+			return "[" + hostname + "]"
+		}
+		return hostname
+	}
+
+	return host
+}
+
+// Drop and sort params in raw query.
+func (c *Canonicalizer) canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	params := []string{}
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" || c.dropped(paramKey(param)) {
+			continue
+		}
+
+		params = append(params, param)
+	}
+
+	if c.sortQuery {
+		sort.SliceStable(params, func(i, j int) bool {
+			return paramKey(params[i]) < paramKey(params[j])
+		})
+	}
+
+	return strings.Join(params, "&")
+}
+
+// Check whether param named key should be dropped.
+func (c *Canonicalizer) dropped(key string) bool {
+	for _, pattern := range c.dropParams {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get unescaped key of param like "key=value".
+func paramKey(param string) string {
+	key := param
+	if i := strings.Index(param, "="); i >= 0 {
+		key = param[:i]
+	}
+
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+
+	return key
+}
+
+// Remove "." and ".." segments in path, as RFC 3986 5.2.4.
+func removeDotSegments(p string) string {
+	if p == "" {
+		return ""
+	}
+
+	segments := strings.Split(p, "/")
+	out := []string{}
+
+	for i, seg := range segments {
+		last := i == len(segments)-1
+
+		switch seg {
+		case ".":
+			// "/a/." equals "/a/"
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			// never pop the leading empty segment of absolute path
+			if len(out) > 1 || (len(out) == 1 && out[0] != "") {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+
+	result := strings.Join(out, "/")
+	if strings.HasPrefix(p, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+
+	return result
+}
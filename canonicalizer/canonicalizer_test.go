@@ -0,0 +1,86 @@
+// canonicalizer_test.go - UT for canonicalizer.go.
+
+package canonicalizer
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func canonicalize(t *testing.T, c *Canonicalizer, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	assert.NoError(t, err)
+
+	return c.Canonicalize(u).String()
+}
+
+func TestCanonicalize(t *testing.T) {
+	c := NewCanonicalizer(false, nil)
+
+	cases := map[string]string{
+		"http://a.com/x#frag":       "http://a.com/x",
+		"HTTP://A.com:80/x":         "http://a.com/x",
+		"https://a.com:443/x":       "https://a.com/x",
+		"http://a.com:443/x":        "http://a.com:443/x",
+		"http://a.com:8080/x":       "http://a.com:8080/x",
+		"http://a.com/./x":          "http://a.com/x",
+		"http://a.com/a/b/../../x":  "http://a.com/x",
+		"http://a.com/../x":         "http://a.com/x",
+		"http://a.com/a/b/..":       "http://a.com/a/",
+		"http://a.com/a/.":          "http://a.com/a/",
+		"http://a.com":              "http://a.com/",
+		"http://a.com?":             "http://a.com/",
+		"http://a.com/x?b=2&a=1":    "http://a.com/x?b=2&a=1",
+		"http://[::1]:80/x":         "http://[::1]/x",
+		"http://a.com/%7Ex/%2F/./y": "http://a.com/%7Ex/%2F/y",
+		"http://user@A.com/x":       "http://user@a.com/x",
+		"mailto:someone@a.com":      "mailto:someone@a.com",
+	}
+
+	for rawURL, expect := range cases {
+		assert.Equal(t, expect, canonicalize(t, c, rawURL), rawURL)
+	}
+}
+
+func TestCanonicalize_Query(t *testing.T) {
+	c := NewCanonicalizer(true, []string{"utm_*", "from"})
+
+	cases := map[string]string{
+		"http://a.com/x?b=2&a=1":                           "http://a.com/x?a=1&b=2",
+		"http://a.com/x?b=2&a=1&a=0":                       "http://a.com/x?a=1&a=0&b=2",
+		"http://a.com/x?utm_source=x&b=2&utm_medium=y&a=1": "http://a.com/x?a=1&b=2",
+		"http://a.com/x?from=baidu":                        "http://a.com/x",
+		"http://a.com/x?fromto=1&&":                        "http://a.com/x?fromto=1",
+		"http://a.com/x?%75tm_source=1":                    "http://a.com/x",
+	}
+
+	for rawURL, expect := range cases {
+		assert.Equal(t, expect, canonicalize(t, c, rawURL), rawURL)
+	}
+}
+
+func TestCanonicalize_NotModified(t *testing.T) {
+	c := NewCanonicalizer(true, nil)
+
+	u, err := url.Parse("HTTP://A.com:80/./x?b=2&a=1#frag")
+	assert.NoError(t, err)
+
+	c.Canonicalize(u)
+	assert.Equal(t, "http://A.com:80/./x?b=2&a=1#frag", u.String())
+}
+
+func TestHost(t *testing.T) {
+	for rawURL, expect := range map[string]string{
+		"http://WWW.Baidu.com/a":     "www.baidu.com",
+		"http://www.baidu.com:80/":   "www.baidu.com",
+		"https://www.baidu.com:443/": "www.baidu.com",
+		"http://www.baidu.com:8080/": "www.baidu.com:8080",
+		"http://[::1]:80/":           "[::1]",
+	} {
+		u, err := url.Parse(rawURL)
+		assert.NoError(t, err)
+		assert.Equal(t, expect, Host(u), rawURL)
+	}
+}
@@ -0,0 +1,226 @@
+// checkpoint.go - append-only log of crawl frontier, used for resuming.
+
+package checkpoint
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+)
+
+const (
+	logFileName = "frontier.log"
+
+	opAdd   = "add"   // task added to task queue
+	opDone  = "done"  // task finished
+	opVisit = "visit" // task added and finished, written by compaction only
+)
+
+// one line of log
+type record struct {
+	Op    string `json:"op"`
+	URL   string `json:"url"`
+	Depth int    `json:"depth,omitempty"`
+}
+
+// Task is a pending task saved in checkpoint.
+type Task struct {
+	URL   string
+	Depth int
+}
+
+type Checkpoint struct {
+	filePath string
+
+	// state replayed from log when opened
+	pending []Task
+	visited []string
+
+	lock sync.Mutex // protect file
+	file *os.File
+}
+
+// Open opens checkpoint under directory.
+//
+// Params:
+//	- directory: directory of checkpoint, created if not exist.
+//	- resume: if true, replay and compact log left by last run, else drop it.
+//
+// Returns:
+//	- (checkpoint, err msg).
+func Open(directory string, resume bool) (*Checkpoint, error) {
+	err := os.MkdirAll(directory, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("directory: %s, os.MkdirAll(): %v", directory, err)
+	}
+
+	c := &Checkpoint{filePath: path.Join(directory, logFileName)}
+
+	if resume {
+		err = c.replay()
+		if err != nil {
+			return nil, fmt.Errorf("replay(): %v", err)
+		}
+
+		err = c.compact()
+		if err != nil {
+			return nil, fmt.Errorf("compact(): %v", err)
+		}
+	}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !resume {
+		flag |= os.O_TRUNC
+	}
+
+	c.file, err = os.OpenFile(c.filePath, flag, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(): %s, err: %v", c.filePath, err)
+	}
+
+	return c, nil
+}
+
+// Load gets pending tasks and visited URLs saved by last run.
+// Both are empty if checkpoint is not opened for resuming.
+func (c *Checkpoint) Load() ([]Task, []string, error) {
+	return c.pending, c.visited, nil
+}
+
+// Add records a task added to task queue, its URL is visited from now on.
+func (c *Checkpoint) Add(url string, depth int) error {
+	return c.write(record{opAdd, url, depth})
+}
+
+// Done records a task finished.
+func (c *Checkpoint) Done(url string) error {
+	return c.write(record{Op: opDone, URL: url})
+}
+
+// Close closes checkpoint.
+func (c *Checkpoint) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.file.Close()
+}
+
+// Append one record to log.
+func (c *Checkpoint) write(r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("json.Marshal(): %v", err)
+	}
+	line = append(line, '\n')
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, err = c.file.Write(line)
+	if err != nil {
+		return fmt.Errorf("write to file: %s failed, err: %v", c.filePath, err)
+	}
+
+	return nil
+}
+
+// Rebuild pending tasks and visited URLs from log.
+func (c *Checkpoint) replay() error {
+	f, err := os.Open(c.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("os.Open(): %s, err: %v", c.filePath, err)
+	}
+	defer f.Close()
+
+	visited := make(map[string]bool)
+	depths := make(map[string]int) // pending URL => depth
+	order := []string{}            // pending URLs in order of adding
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r record
+		// the last line may be broken by crash, skip it
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+
+		switch r.Op {
+		case opAdd:
+			if !visited[r.URL] {
+				visited[r.URL] = true
+				depths[r.URL] = r.Depth
+				order = append(order, r.URL)
+			}
+		case opDone:
+			delete(depths, r.URL)
+		case opVisit:
+			visited[r.URL] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read file: %s failed, err: %v", c.filePath, err)
+	}
+
+	for _, u := range order {
+		if depth, ok := depths[u]; ok {
+			c.pending = append(c.pending, Task{u, depth})
+		}
+	}
+
+	for u := range visited {
+		if _, ok := depths[u]; !ok {
+			c.visited = append(c.visited, u)
+		}
+	}
+
+	return nil
+}
+
+// Rewrite log with replayed state only, so log does not grow across runs.
+func (c *Checkpoint) compact() error {
+	tmpPath := c.filePath + ".tmp"
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("os.Create(): %s, err: %v", tmpPath, err)
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	for _, u := range c.visited {
+		if err = enc.Encode(record{Op: opVisit, URL: u}); err != nil {
+			break
+		}
+	}
+	for _, t := range c.pending {
+		if err != nil {
+			break
+		}
+		err = enc.Encode(record{opAdd, t.URL, t.Depth})
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("write to file: %s failed, err: %v", tmpPath, err)
+	}
+
+	err = os.Rename(tmpPath, c.filePath)
+	if err != nil {
+		return fmt.Errorf("os.Rename(): %s, err: %v", tmpPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+// checkpoint_test.go - UT for checkpoint.go.
+
+package checkpoint
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpen_Resume(t *testing.T) {
+	directory := "./test_checkpoint"
+	defer func() {
+		// remove UT output
+		assert.NoError(t, os.RemoveAll(directory))
+	}()
+
+	c, err := Open(directory, false)
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.Add("http://www.baidu.com", 1))
+	assert.NoError(t, c.Add("http://www.baidu1.com", 0))
+	assert.NoError(t, c.Add("http://www.baidu2.com", 0))
+	assert.NoError(t, c.Done("http://www.baidu.com"))
+	assert.NoError(t, c.Close())
+
+	// resume twice, state should be kept by compaction
+	for i := 0; i < 2; i++ {
+		c, err = Open(directory, true)
+		assert.NoError(t, err)
+
+		pending, visited, err := c.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, []Task{{"http://www.baidu1.com", 0}, {"http://www.baidu2.com", 0}}, pending)
+		assert.Equal(t, []string{"http://www.baidu.com"}, visited)
+
+		assert.NoError(t, c.Close())
+	}
+
+	c, err = Open(directory, true)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Done("http://www.baidu1.com"))
+	assert.NoError(t, c.Close())
+
+	c, err = Open(directory, true)
+	assert.NoError(t, err)
+	pending, visited, err := c.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Task{{"http://www.baidu2.com", 0}}, pending)
+	assert.ElementsMatch(t, []string{"http://www.baidu.com", "http://www.baidu1.com"}, visited)
+	assert.NoError(t, c.Close())
+}
+
+func TestOpen_NotResume(t *testing.T) {
+	directory := "./test_checkpoint1"
+	defer func() {
+		// remove UT output
+		assert.NoError(t, os.RemoveAll(directory))
+	}()
+
+	c, err := Open(directory, false)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Add("http://www.baidu.com", 1))
+	assert.NoError(t, c.Close())
+
+	// log of last run is dropped
+	c, err = Open(directory, false)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Close())
+
+	c, err = Open(directory, true)
+	assert.NoError(t, err)
+	pending, visited, err := c.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+	assert.Empty(t, visited)
+	assert.NoError(t, c.Close())
+}
+
+func TestOpen_BrokenLastLine(t *testing.T) {
+	directory := "./test_checkpoint2"
+	defer func() {
+		// remove UT output
+		assert.NoError(t, os.RemoveAll(directory))
+	}()
+
+	assert.NoError(t, os.MkdirAll(directory, os.ModePerm))
+
+	content := "{\"op\":\"add\",\"url\":\"http://www.baidu.com\",\"depth\":1}\n{\"op\":\"do"
+	f, err := os.Create(path.Join(directory, logFileName))
+	assert.NoError(t, err)
+	_, err = f.WriteString(content)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	c, err := Open(directory, true)
+	assert.NoError(t, err)
+	pending, visited, err := c.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Task{{"http://www.baidu.com", 1}}, pending)
+	assert.Empty(t, visited)
+	assert.NoError(t, c.Close())
+}
@@ -13,6 +13,15 @@ type Config struct {
 	Crawler  CrawlerConf
 	Fetcher  FetcherConf
 	Outputer OutputerConf
+	Robots   RobotsConf
+	Scope    ScopeConf
+	Metrics  MetricsConf
+
+	// sections of outputer backends, checked only if selected by Outputer.Type
+	OutputerWARC   WARCOutputerConf   `gcfg:"outputer-warc"`
+	OutputerJSONL  JSONLOutputerConf  `gcfg:"outputer-jsonl"`
+	OutputerSQLite SQLiteOutputerConf `gcfg:"outputer-sqlite"`
+	OutputerS3     S3OutputerConf     `gcfg:"outputer-s3"`
 }
 
 func (c *Config) load(confPath string) error {
@@ -42,16 +51,58 @@ func (c *Config) check() error {
 		return fmt.Errorf("Outputer check faild: %v", err)
 	}
 
+	err = c.checkOutputerBackend()
+	if err != nil {
+		return err
+	}
+
+	err = c.Robots.Check()
+	if err != nil {
+		return fmt.Errorf("Robots check faild: %v", err)
+	}
+
+	err = c.Scope.Check()
+	if err != nil {
+		return fmt.Errorf("Scope check faild: %v", err)
+	}
+
+	err = c.Metrics.Check()
+	if err != nil {
+		return fmt.Errorf("Metrics check faild: %v", err)
+	}
+
+	return nil
+}
+
+// Check section of outputer backend selected by Outputer.Type, other backends have nothing to check.
+func (c *Config) checkOutputerBackend() error {
+	var err error
+
+	switch c.Outputer.Type {
+	case "warc":
+		err = c.OutputerWARC.Check()
+	case "jsonl":
+		err = c.OutputerJSONL.Check()
+	case "sqlite":
+		err = c.OutputerSQLite.Check()
+	case "s3":
+		err = c.OutputerS3.Check()
+	}
+
+	if err != nil {
+		return fmt.Errorf("Outputer-%s check faild: %v", c.Outputer.Type, err)
+	}
+
 	return nil
 }
 
 // LoadAndCheck loads config from file.
 //
 // Param:
-//	- confPath: file path of config.
+//   - confPath: file path of config.
 //
 // Returns:
-//	- (SpiderConf, err msg).
+//   - (SpiderConf, err msg).
 func LoadAndCheck(confPath string) (Config, error) {
 	var conf Config
 	var err error
@@ -5,28 +5,141 @@ package conf
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+func TestLoadAndCheck_Default(t *testing.T) {
+	// config shipped with spider
+	cfg, err := LoadAndCheck("../config/spider.conf")
+	assert.NoError(t, err)
+
+	assert.False(t, cfg.Robots.Enable)
+	assert.False(t, cfg.Metrics.Enable)
+	assert.Equal(t, ScopeConf{}, cfg.Scope)
+
+	// same behaviour as before these options
+	assert.False(t, cfg.Outputer.SaveMetadata)
+	assert.Empty(t, cfg.Outputer.AllowedMIME)
+	assert.Equal(t, []string{"a.href"}, cfg.Crawler.LinkExtractor)
+	assert.False(t, cfg.Crawler.ObeyNofollow)
+	assert.False(t, cfg.Crawler.ObeyNoindex)
+	assert.False(t, cfg.Crawler.SortQuery)
+	assert.Empty(t, cfg.Crawler.DropQueryParam)
+	assert.Empty(t, cfg.Crawler.HostInterval)
+	assert.Empty(t, cfg.Crawler.HostMaxConns)
+	assert.False(t, cfg.Fetcher.TranscodeToUTF8)
+	assert.Equal(t, int64(0), cfg.Fetcher.MaxBodySize)
+	assert.Equal(t, 1, cfg.Fetcher.MaxAttempts)
+	assert.True(t, cfg.Fetcher.CrossHostRedirect)
+	assert.Empty(t, cfg.Fetcher.CacheDirectory)
+}
+
 func TestLoadAndCheck_NormalCase(t *testing.T) {
 	confPath := "./testdata/spider.conf"
 
 	expectConf := Config{
 		Basic: BasicConf{
-			"../data/url.data",
+			UrlListFile: "../data/url.data",
 		},
 		Crawler: CrawlerConf{
-			1,
-			1,
-			8,
+			MaxDepth:      1,
+			CrawlInterval: Duration(time.Second),
+			ThreadCount:   8,
+
+			MaxConnsPerHost: 1,
+			HostInterval:    []string{"www.baidu.com 500ms"},
+			HostMaxConns:    []string{"www.baidu.com 2"},
+
+			AdaptiveInterval: true,
+			MinCrawlInterval: Duration(500 * time.Millisecond),
+			MaxCrawlInterval: Duration(30 * time.Second),
+
+			FrontierMemorySize: 100000,
+			FrontierDirectory:  "../frontier",
+
+			FrontierOrder: "score",
+			ScoreRule:     []string{"\\.html?$ 10", "/(login|logout)/ -10"},
+
+			LinkExtractor: []string{"a.href", "area.href", "iframe.src", "frame.src", "meta.refresh"},
+			ObeyNofollow:  true,
+			ObeyNoindex:   true,
+
+			VisitedSet:             "memory",
+			BloomCapacity:          1000000,
+			BloomFalsePositiveRate: 0.001,
+			VisitedSetDirectory:    "../visited",
+
+			SortQuery:      true,
+			DropQueryParam: []string{"utm_*", "spm"},
+
+			CheckpointDirectory: "../checkpoint",
+
+			Daemon:             false,
+			RecrawlInterval:    3600,
+			MinRevisitInterval: 3600,
+			MaxRevisitInterval: 86400,
 		},
 		Fetcher: FetcherConf{
-			1,
+			CrawlTimeout:    1,
+			MaxBodySize:     10485760,
+			TranscodeToUTF8: true,
+			CacheDirectory:  "../cache",
+			MaxAttempts:     3,
+			RetryBackoff:    500,
+			RetryMaxBackoff: 10000,
+			RetryStatus:     []int{429, 502, 503, 504},
+			RetryError:      []string{"timeout", "network"},
+			MaxRetryAfter:   60,
+
+			MaxRedirects:      10,
+			CrossHostRedirect: false,
 		},
 		Outputer: OutputerConf{
-			"../output",
-			".*.(htm|html)$",
+			OutputDirectory: "../output",
+			TargetURL:       ".*.(htm|html)$",
+			SaveMetadata:    true,
+			AllowedMIME:     []string{"text/html", "application/xhtml+xml", "image/*"},
+
+			Type:             "filesystem",
+			ContentAddressed: true,
+			Compression:      "zstd",
+			CompressionLevel: 3,
+		},
+		OutputerWARC: WARCOutputerConf{
+			Prefix:  "spider",
+			MaxSize: 1073741824,
+		},
+		OutputerJSONL: JSONLOutputerConf{
+			File: "../output/pages.jsonl",
+		},
+		OutputerSQLite: SQLiteOutputerConf{
+			File:  "../output/pages.db",
+			Table: "pages",
+		},
+		OutputerS3: S3OutputerConf{
+			Endpoint: "http://127.0.0.1:9000",
+			Region:   "us-east-1",
+			Bucket:   "spider",
+			Prefix:   "pages/",
+		},
+		Robots: RobotsConf{
+			Enable:    true,
+			UserAgent: "mini_spider",
+		},
+		Scope: ScopeConf{
+			AllowedHost:    []string{"baidu.com", "sina.com.cn"},
+			DeniedHost:     []string{"passport.baidu.com"},
+			IncludeURL:     []string{"^https?://"},
+			ExcludeURL:     []string{"\\.(jpg|png|gif|css|js)$"},
+			AllowedScheme:  []string{"http", "https"},
+			SameHostAsSeed: false,
+		},
+		Metrics: MetricsConf{
+			Enable:  true,
+			Address: "127.0.0.1:9090",
+			Path:    "/metrics",
 		},
 	}
 
@@ -77,3 +190,105 @@ func TestLoadAndCheck_InvalidThreadCount(t *testing.T) {
 	_, err := LoadAndCheck(confPath)
 	assert.True(t, strings.Contains(err.Error(), "ThreadCount should > 0"))
 }
+
+func TestLoadAndCheck_EmptyRobotsUserAgent(t *testing.T) {
+	confPath := "./testdata/spider8.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "Empty UserAgent"))
+}
+
+func TestLoadAndCheck_InvalidDropQueryParam(t *testing.T) {
+	confPath := "./testdata/spider10.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "DropQueryParam [utm: syntax error in pattern"))
+}
+
+func TestLoadAndCheck_InvalidRevisitInterval(t *testing.T) {
+	confPath := "./testdata/spider9.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "MaxRevisitInterval should >= MinRevisitInterval"))
+}
+
+func TestLoadAndCheck_InvalidExcludeURL(t *testing.T) {
+	confPath := "./testdata/spider11.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "Invalid URL pattern"))
+}
+
+func TestLoadAndCheck_InvalidBloomFalsePositiveRate(t *testing.T) {
+	confPath := "./testdata/spider12.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "BloomFalsePositiveRate should in (0, 1)"))
+}
+
+func TestLoadAndCheck_EmptyMetricsAddress(t *testing.T) {
+	confPath := "./testdata/spider13.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "Empty Address"))
+}
+
+func TestLoadAndCheck_InvalidRetryStatus(t *testing.T) {
+	confPath := "./testdata/spider14.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "Invalid RetryStatus: 700"))
+}
+
+func TestLoadAndCheck_InvalidAllowedMIME(t *testing.T) {
+	confPath := "./testdata/spider15.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "Invalid AllowedMIME: image/["))
+}
+
+func TestLoadAndCheck_InvalidHostMaxConns(t *testing.T) {
+	confPath := "./testdata/spider16.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "invalid host value: www.baidu.com two"))
+}
+
+func TestLoadAndCheck_InvalidCrawlIntervalDuration(t *testing.T) {
+	confPath := "./testdata/spider17.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "invalid duration: 1x"))
+}
+
+func TestLoadAndCheck_CrawlIntervalOutOfAdaptiveBounds(t *testing.T) {
+	confPath := "./testdata/spider18.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "CrawlInterval should in [MinCrawlInterval, MaxCrawlInterval]"))
+}
+
+func TestLoadAndCheck_InvalidFrontierMemorySize(t *testing.T) {
+	confPath := "./testdata/spider19.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "FrontierMemorySize should >= 0"))
+}
+
+func TestLoadAndCheck_InvalidFrontierOrder(t *testing.T) {
+	confPath := "./testdata/spider20.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "Invalid FrontierOrder: dfs"))
+}
+
+func TestLoadAndCheck_InvalidScoreRule(t *testing.T) {
+	confPath := "./testdata/spider21.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "invalid score rule: /(login|logout)/ high"))
+}
+
+func TestLoadAndCheck_EmptyS3Bucket(t *testing.T) {
+	confPath := "./testdata/spider22.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "Outputer-s3 check faild: Empty Bucket"))
+}
+
+func TestLoadAndCheck_InvalidCompressionLevel(t *testing.T) {
+	confPath := "./testdata/spider23.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "Invalid CompressionLevel: 23"))
+}
+
+func TestLoadAndCheck_CompressionNotSupported(t *testing.T) {
+	confPath := "./testdata/spider24.conf"
+	_, err := LoadAndCheck(confPath)
+	assert.True(t, strings.Contains(err.Error(), "Compression not supported by Type: jsonl"))
+}
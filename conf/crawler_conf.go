@@ -4,12 +4,51 @@ package conf
 
 import (
 	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type CrawlerConf struct {
-	MaxDepth      int // max depth when crawl, depth eqauls to zero for seeds
-	CrawlInterval int // crawl interval, in seconds
-	ThreadCount   int // count of thread for spider
+	MaxDepth      int      // max depth when crawl, depth eqauls to zero for seeds
+	CrawlInterval Duration // crawl interval of one host, like "250ms", in seconds if a bare integer
+	ThreadCount   int      // count of thread for spider
+
+	MaxConnsPerHost int      // max tasks of one host crawled concurrently, 1 if 0
+	HostInterval    []string // per-host crawl interval overrides like "www.baidu.com 500ms", multi-valued
+	HostMaxConns    []string // per-host MaxConnsPerHost overrides like "www.baidu.com 2", multi-valued
+
+	AdaptiveInterval bool     // adapt crawl interval of hosts to their latency and errors
+	MinCrawlInterval Duration // lower bound of adaptive crawl interval
+	MaxCrawlInterval Duration // upper bound of adaptive crawl interval
+
+	FrontierMemorySize int    // max tasks queued in memory, the rest are spilled to disk, 100000 if 0
+	FrontierDirectory  string // directory of spilled tasks, system temp directory if empty
+
+	FrontierOrder string   // order of tasks in memory: "fifo", "bfs", "score" or "roundrobin", "fifo" if empty
+	ScoreRule     []string // URL pattern weights like "\\.html$ 10" for "score" order, score is sum of matched weights, multi-valued
+
+	LinkExtractor []string // link extractors like "a.href", multi-valued, "a.href" only if empty
+
+	ObeyNofollow bool // skip rel="nofollow" links and links in pages with meta robots nofollow
+	ObeyNoindex  bool // do not output pages with meta robots noindex
+
+	VisitedSet             string  // type of visited set: "memory", "bloom" or "disk", "memory" if empty
+	BloomCapacity          int     // count of keys of the first filter in bloom visited set
+	BloomFalsePositiveRate float64 // upper bound of false positive rate of bloom visited set
+	VisitedSetDirectory    string  // directory of disk visited set
+
+	SortQuery      bool     // sort query params when deduplicating URLs
+	DropQueryParam []string // glob patterns of query params dropped when deduplicating URLs, like "utm_*", multi-valued
+
+	CheckpointDirectory string // directory for saving crawl frontier, disabled if empty
+
+	Daemon             bool // run as daemon, re-crawl seeds circularly
+	RecrawlInterval    int  // interval between rounds of daemon, in seconds
+	MinRevisitInterval int  // min interval for revisiting one URL in daemon mode, in seconds
+	MaxRevisitInterval int  // max interval for revisiting one URL in daemon mode, in seconds
 }
 
 // Check checks crawler's config at the semantic level.
@@ -26,5 +65,178 @@ func (c *CrawlerConf) Check() error {
 		return fmt.Errorf("ThreadCount should > 0")
 	}
 
+	if c.MaxConnsPerHost < 0 {
+		return fmt.Errorf("MaxConnsPerHost should >= 0")
+	}
+
+	intervals, err := ParseHostDurations(c.HostInterval)
+	if err != nil {
+		return fmt.Errorf("HostInterval: %v", err)
+	}
+	for host, interval := range intervals {
+		if interval <= 0 {
+			return fmt.Errorf("HostInterval of %s should > 0", host)
+		}
+	}
+
+	maxConns, err := ParseHostValues(c.HostMaxConns)
+	if err != nil {
+		return fmt.Errorf("HostMaxConns: %v", err)
+	}
+	for host, n := range maxConns {
+		if n <= 0 {
+			return fmt.Errorf("HostMaxConns of %s should > 0", host)
+		}
+	}
+
+	if c.AdaptiveInterval {
+		if c.MinCrawlInterval <= 0 {
+			return fmt.Errorf("MinCrawlInterval should > 0")
+		}
+
+		if c.MaxCrawlInterval < c.MinCrawlInterval {
+			return fmt.Errorf("MaxCrawlInterval should >= MinCrawlInterval")
+		}
+
+		if c.CrawlInterval < c.MinCrawlInterval || c.CrawlInterval > c.MaxCrawlInterval {
+			return fmt.Errorf("CrawlInterval should in [MinCrawlInterval, MaxCrawlInterval]")
+		}
+	}
+
+	if c.FrontierMemorySize < 0 {
+		return fmt.Errorf("FrontierMemorySize should >= 0")
+	}
+
+	switch c.FrontierOrder {
+	case "", "fifo", "bfs", "roundrobin":
+	case "score":
+		if _, err := ParseScoreRules(c.ScoreRule); err != nil {
+			return fmt.Errorf("ScoreRule: %v", err)
+		}
+	default:
+		return fmt.Errorf("Invalid FrontierOrder: %s", c.FrontierOrder)
+	}
+
+	switch c.VisitedSet {
+	case "", "memory":
+	case "bloom":
+		if c.BloomCapacity <= 0 {
+			return fmt.Errorf("BloomCapacity should > 0")
+		}
+
+		if c.BloomFalsePositiveRate <= 0 || c.BloomFalsePositiveRate >= 1 {
+			return fmt.Errorf("BloomFalsePositiveRate should in (0, 1)")
+		}
+	case "disk":
+		if c.VisitedSetDirectory == "" {
+			return fmt.Errorf("Empty VisitedSetDirectory")
+		}
+	default:
+		return fmt.Errorf("Unknown VisitedSet: %s", c.VisitedSet)
+	}
+
+	for _, pattern := range c.DropQueryParam {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("DropQueryParam %s: %v", pattern, err)
+		}
+	}
+
+	if c.Daemon {
+		if c.RecrawlInterval <= 0 {
+			return fmt.Errorf("RecrawlInterval should > 0")
+		}
+
+		if c.MinRevisitInterval <= 0 {
+			return fmt.Errorf("MinRevisitInterval should > 0")
+		}
+
+		if c.MaxRevisitInterval < c.MinRevisitInterval {
+			return fmt.Errorf("MaxRevisitInterval should >= MinRevisitInterval")
+		}
+	}
+
 	return nil
 }
+
+// ParseHostValues parses per-host values like "www.baidu.com 5" into host => value,
+// hosts are lower-cased.
+func ParseHostValues(list []string) (map[string]int, error) {
+	values := make(map[string]int)
+	for _, item := range list {
+		host, field, err := splitHostValue(item)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host value: %s", item)
+		}
+
+		values[host] = value
+	}
+
+	return values, nil
+}
+
+// ParseHostDurations parses per-host durations like "www.baidu.com 500ms" into host => duration,
+// hosts are lower-cased, a bare integer is in seconds.
+func ParseHostDurations(list []string) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration)
+	for _, item := range list {
+		host, field, err := splitHostValue(item)
+		if err != nil {
+			return nil, err
+		}
+
+		d, err := parseDuration(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host value: %s", item)
+		}
+
+		durations[host] = d
+	}
+
+	return durations, nil
+}
+
+// Split item like "www.baidu.com 5" into lower-cased host and value.
+func splitHostValue(item string) (string, string, error) {
+	fields := strings.Fields(item)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("invalid host value: %s", item)
+	}
+
+	return strings.ToLower(fields[0]), fields[1], nil
+}
+
+// ScoreRule adds Weight to score of URLs matching Pattern.
+type ScoreRule struct {
+	Pattern *regexp.Regexp
+	Weight  float64
+}
+
+// ParseScoreRules parses rules like "\\.html$ 10", weight is the last field.
+func ParseScoreRules(list []string) ([]ScoreRule, error) {
+	rules := []ScoreRule{}
+	for _, item := range list {
+		i := strings.LastIndexAny(item, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid score rule: %s", item)
+		}
+
+		weight, err := strconv.ParseFloat(item[i+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid score rule: %s", item)
+		}
+
+		pattern, err := regexp.Compile(strings.TrimSpace(item[:i]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid score rule: %s, regexp.Compile(): %v", item, err)
+		}
+
+		rules = append(rules, ScoreRule{Pattern: pattern, Weight: weight})
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,44 @@
+// duration.go - Duration type of config.
+
+package conf
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Duration is a duration in config like "250ms" or "1m30s",
+// a bare integer is in seconds, for compatibility with former configs.
+type Duration time.Duration
+
+// UnmarshalText implements encoding.TextUnmarshaler, used by gcfg.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := parseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+// String gets d like "250ms".
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Parse duration like "250ms", or a bare integer in seconds.
+func parseDuration(s string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+
+	return d, nil
+}
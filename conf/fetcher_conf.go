@@ -4,8 +4,30 @@ package conf
 
 import "fmt"
 
+// network error classes which can be retried
+const (
+	RetryErrorTimeout = "timeout" // connect or read timeout
+	RetryErrorDNS     = "dns"     // DNS lookup failure
+	RetryErrorNetwork = "network" // connection refused, reset, unexpected EOF and so on
+)
+
 type FetcherConf struct {
-	CrawlTimeout int // crawl timeout, in seconds
+	CrawlTimeout int   // crawl timeout, in seconds
+	MaxBodySize  int64 // max size of body, larger ones are dropped, unlimited if 0, in bytes
+
+	TranscodeToUTF8 bool // transcode text bodies to UTF-8 before parsing and saving
+
+	CacheDirectory string // directory storing ETag, Last-Modified and bodies for conditional requests, disabled if empty
+
+	MaxAttempts     int      // max attempts of one fetch, no retry if <= 1
+	RetryBackoff    int      // backoff before the first retry, doubled for each retry, in milliseconds
+	RetryMaxBackoff int      // max backoff between retries, in milliseconds
+	RetryStatus     []int    // status codes which can be retried, 429 and 5xx except 501 if empty
+	RetryError      []string // network error classes which can be retried, timeout and network if empty
+	MaxRetryAfter   int      // max Retry-After honoured, give up if longer, unlimited if 0, in seconds
+
+	MaxRedirects      int  // max redirects followed, 10 if 0, none if -1
+	CrossHostRedirect bool // follow redirects to other hosts or not
 }
 
 // Check checks fetcher's config at the semantic level.
@@ -14,5 +36,39 @@ func (f *FetcherConf) Check() error {
 		return fmt.Errorf("CrawlTimeout should > 0")
 	}
 
+	if f.MaxBodySize < 0 {
+		return fmt.Errorf("MaxBodySize should >= 0")
+	}
+
+	if f.MaxAttempts < 0 {
+		return fmt.Errorf("MaxAttempts should >= 0")
+	}
+
+	if f.RetryBackoff < 0 || f.RetryMaxBackoff < 0 || f.MaxRetryAfter < 0 {
+		return fmt.Errorf("RetryBackoff, RetryMaxBackoff and MaxRetryAfter should >= 0")
+	}
+
+	if f.RetryMaxBackoff < f.RetryBackoff {
+		return fmt.Errorf("RetryMaxBackoff should >= RetryBackoff")
+	}
+
+	if f.MaxRedirects < -1 {
+		return fmt.Errorf("MaxRedirects should >= -1")
+	}
+
+	for _, status := range f.RetryStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("Invalid RetryStatus: %d", status)
+		}
+	}
+
+	for _, class := range f.RetryError {
+		switch class {
+		case RetryErrorTimeout, RetryErrorDNS, RetryErrorNetwork:
+		default:
+			return fmt.Errorf("Invalid RetryError: %s", class)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,31 @@
+// metrics_conf.go - Config for metrics endpoint.
+
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+type MetricsConf struct {
+	Enable  bool   // serve metrics or not
+	Address string // address to listen on, like ":9090"
+	Path    string // path of metrics endpoint, like "/metrics"
+}
+
+// Check checks metrics' config at the semantic level.
+func (m *MetricsConf) Check() error {
+	if !m.Enable {
+		return nil
+	}
+
+	if m.Address == "" {
+		return fmt.Errorf("Empty Address")
+	}
+
+	if !strings.HasPrefix(m.Path, "/") {
+		return fmt.Errorf("Invalid Path: %s", m.Path)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+// outputer_backend_conf.go - Config for outputer backends, each in its own section.
+
+package conf
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// WARCOutputerConf is config of "warc" backend, in section [Outputer-WARC].
+type WARCOutputerConf struct {
+	Prefix  string // prefix of WARC file names, "spider" if empty
+	MaxSize int64  // WARC file is rotated once larger than it, in bytes, 1GB if 0
+}
+
+// Check checks config of "warc" backend at the semantic level.
+func (w *WARCOutputerConf) Check() error {
+	if w.MaxSize < 0 {
+		return fmt.Errorf("MaxSize should >= 0")
+	}
+
+	return nil
+}
+
+// JSONLOutputerConf is config of "jsonl" backend, in section [Outputer-JSONL].
+type JSONLOutputerConf struct {
+	File string // path of JSON Lines file, appended to if exists
+}
+
+// Check checks config of "jsonl" backend at the semantic level.
+func (j *JSONLOutputerConf) Check() error {
+	if j.File == "" {
+		return fmt.Errorf("Empty File")
+	}
+
+	return nil
+}
+
+// SQLiteOutputerConf is config of "sqlite" backend, in section [Outputer-SQLite].
+type SQLiteOutputerConf struct {
+	File  string // path of SQLite database, created if not exists
+	Table string // table of pages, created if not exists, "pages" if empty
+}
+
+// Check checks config of "sqlite" backend at the semantic level.
+func (s *SQLiteOutputerConf) Check() error {
+	if s.File == "" {
+		return fmt.Errorf("Empty File")
+	}
+
+	for _, c := range s.Table {
+		if !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return fmt.Errorf("Invalid Table: %s", s.Table)
+		}
+	}
+
+	return nil
+}
+
+// S3OutputerConf is config of "s3" backend, in section [Outputer-S3].
+// Objects are put by path-style URLs like Endpoint/Bucket/Key, signed by AWS signature V4.
+type S3OutputerConf struct {
+	Endpoint  string // URL of S3-compatible endpoint, like "http://127.0.0.1:9000"
+	Region    string // region for signing, "us-east-1" if empty
+	Bucket    string // bucket of objects
+	Prefix    string // prefix of object keys
+	AccessKey string // access key, requests are not signed if empty
+	SecretKey string // secret key
+}
+
+// Check checks config of "s3" backend at the semantic level.
+func (s *S3OutputerConf) Check() error {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid Endpoint: %s", s.Endpoint)
+	}
+
+	if s.Bucket == "" {
+		return fmt.Errorf("Empty Bucket")
+	}
+
+	if s.AccessKey != "" && s.SecretKey == "" {
+		return fmt.Errorf("Empty SecretKey")
+	}
+
+	return nil
+}
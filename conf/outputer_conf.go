@@ -2,11 +2,35 @@
 
 package conf
 
-import "fmt"
+import (
+	"fmt"
+	"path"
+)
 
 type OutputerConf struct {
-	OutputDirectory string // path of files which save result
-	TargetURL       string // pattern for target URLs
+	Type            string   // backend of output, registered in package outputer, "filesystem" if empty
+	OutputDirectory string   // path of files which save result
+	TargetURL       string   // pattern for target URLs
+	SaveMetadata    bool     // save metadata like status and headers alongside each file or object
+	AllowedMIME     []string // glob patterns of media types to save, like "image/*", all saved if empty
+
+	ContentAddressed bool // save bodies once by SHA-256, files named by URLs record SHA-256 only, for filesystem type
+
+	Compression      string // codec of saved bodies, "gzip" or "zstd", not compressed if empty, for filesystem and hierarchical types
+	CompressionLevel int    // level of codec, gzip in [1, 9], zstd in [1, 22], default level of codec if 0
+}
+
+// types of outputer supporting compression, "" is filesystem
+var compressionTypes = map[string]bool{
+	"":             true,
+	"filesystem":   true,
+	"hierarchical": true,
+}
+
+// max compression level of codecs
+var compressionMaxLevels = map[string]int{
+	"gzip": 9,
+	"zstd": 22,
 }
 
 // Check checks outputer's config at the semantic level.
@@ -19,5 +43,26 @@ func (o *OutputerConf) Check() error {
 		return fmt.Errorf("Empty TargetURL")
 	}
 
+	for _, pattern := range o.AllowedMIME {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid AllowedMIME: %s", pattern)
+		}
+	}
+
+	if o.Compression != "" {
+		if !compressionTypes[o.Type] {
+			return fmt.Errorf("Compression not supported by Type: %s", o.Type)
+		}
+
+		maxLevel, ok := compressionMaxLevels[o.Compression]
+		if !ok {
+			return fmt.Errorf("Invalid Compression: %s", o.Compression)
+		}
+
+		if o.CompressionLevel < 0 || o.CompressionLevel > maxLevel {
+			return fmt.Errorf("Invalid CompressionLevel: %d", o.CompressionLevel)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,19 @@
+// robots_conf.go - Config for robots.txt.
+
+package conf
+
+import "fmt"
+
+type RobotsConf struct {
+	Enable    bool   // obey robots.txt or not
+	UserAgent string // user agent matched against robots.txt groups
+}
+
+// Check checks robots' config at the semantic level.
+func (r *RobotsConf) Check() error {
+	if r.Enable && r.UserAgent == "" {
+		return fmt.Errorf("Empty UserAgent")
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+// scope_conf.go - Config for crawl scope.
+
+package conf
+
+import (
+	"fmt"
+	"regexp"
+)
+
+type ScopeConf struct {
+	AllowedHost    []string // host suffixes allowed, all hosts allowed if empty, multi-valued
+	DeniedHost     []string // host suffixes denied, prior to AllowedHost, multi-valued
+	IncludeURL     []string // patterns of URLs, URL should match one of them if not empty, multi-valued
+	ExcludeURL     []string // patterns of URLs, URL should match none of them, multi-valued
+	AllowedScheme  []string // schemes allowed, "http" and "https" if empty, multi-valued
+	SameHostAsSeed bool     // only crawl hosts of seeds
+}
+
+// Check checks scope's config at the semantic level.
+func (s *ScopeConf) Check() error {
+	for _, patterns := range [][]string{s.IncludeURL, s.ExcludeURL} {
+		for _, pattern := range patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("Invalid URL pattern %s: %v", pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -4,7 +4,10 @@ package crawler
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"sync"
 	"time"
@@ -12,207 +15,600 @@ import (
 	"github.com/baidu/go-lib/log"
 	"golang.org/x/net/html"
 
+	"github.com/NKztq/spider/canonicalizer"
+	"github.com/NKztq/spider/checkpoint"
 	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
 	"github.com/NKztq/spider/parser"
+	"github.com/NKztq/spider/visited"
 )
 
-var (
-	taskQueueLength = 10000 // length of Crawler's task queue
-)
-
-// token bucket of length one
-type hostTokenBucket chan bool
-
 type Fetcher interface {
-	// Fetch body of URL.
-	Fetch(url string) ([]byte, error)
+	// Fetch URL, give up when ctx is done. Redirects are followed and recorded in result.
+	Fetch(ctx context.Context, url string) (*fetcher.FetchResult, error)
 }
 
 type Outputer interface {
-	// Output content to file.
-	OutputFile(fileName string, content []byte) error
+	// Output fetched result to file.
+	OutputFile(fileName string, res *fetcher.FetchResult) error
+}
+
+// SavedChecker is implemented by outputers which can tell whether a page is saved already.
+// Pages not modified since last fetch are output again only if they are not saved,
+// outputers not implementing it, like append-only streams, are trusted to have them saved.
+type SavedChecker interface {
+	// Check whether res to be output as fileName is saved already.
+	Saved(fileName string, res *fetcher.FetchResult) bool
+}
+
+type Robots interface {
+	// Check whether URL may be crawled, and get Crawl-delay of its host.
+	Allowed(ctx context.Context, u *url.URL) (bool, time.Duration)
+}
+
+type Scope interface {
+	// Check whether URL should be crawled.
+	InScope(u *url.URL) bool
+}
+
+type Checkpoint interface {
+	// Load pending tasks and visited URLs saved by last run.
+	Load() ([]checkpoint.Task, []string, error)
+
+	// Record a task added to task queue.
+	Add(url string, depth int) error
+
+	// Record a task finished.
+	Done(url string) error
 }
 
 type task struct {
 	url   *url.URL
 	depth int
+
+	// set by scheduler
+	seq           uint64    // sequence of queuing in memory, breaks ties of order
+	score         float64   // score for "score" order
+	queuedAt      time.Time // when task is queued
+	prevAllowed   time.Time // next-allowed time of host before task is dispatched
+	reservedUntil time.Time // next-allowed time of host after task is dispatched
 }
 
 type Crawler struct {
 	// crawler cfg
-	maxDepth      int // max crawling depth
-	crawlInterval int // crawl interval, in seconds
-	threadCount   int // crawling thread limit
+	maxDepth    int // max crawling depth
+	threadCount int // crawling thread limit
+
+	linkExtractors []string          // names of link extractors
+	extractors     parser.Extractors // link extractors for parsing
+
+	obeyNofollow bool // do not follow rel="nofollow" links and links in nofollow pages
+	obeyNoindex  bool // do not output noindex pages
+
+	// daemon cfg
+	recrawlInterval time.Duration // interval between rounds of daemon
+	revisit         *revisitTable // revisit schedule of URLs, nil if not daemon
 
 	seeds []string // urls
 
-	fetchedURL sync.Map
+	canonicalizer *canonicalizer.Canonicalizer // canonicalizer for deduplicating URLs
+	visitedCfg    conf.CrawlerConf             // config for creating c.fetchedURL
+	fetchedURL    visited.Set                  // canonical URLs fetched
 
-	// TODO: Use go-lib/queue instead of WaitGroup&chan as task manager
-	taskManager *sync.WaitGroup // task manager
-	tasks       chan *task      // task queue
+	taskManager *sync.WaitGroup // counts tasks not done
+	scheduler   *scheduler      // queues tasks by host, dispatches them politely
 
-	frequencyLimiter sync.Map // host => host lock
+	routines *sync.WaitGroup // goroutines started by crawler
+	finished chan struct{}   // closed to make workers exit
 
 	// proxy
-	fetcher  Fetcher  // fetcher for crawler
-	outputer Outputer // outputer for crawler
+	fetcher    Fetcher    // fetcher for crawler
+	outputer   Outputer   // outputer for crawler
+	robots     Robots     // robots.txt checker for crawler, nil if robots.txt is ignored
+	checkpoint Checkpoint // checkpoint for crawler, nil if not saved
+	scope      Scope      // scope for crawler, nil if all URLs are crawled
 }
 
-func NewCrawler(cfg conf.CrawlerConf, seeds []string, fetcher Fetcher, outputer Outputer) *Crawler {
-	return &Crawler{
-		maxDepth:      cfg.MaxDepth,
-		crawlInterval: cfg.CrawlInterval,
-		threadCount:   cfg.ThreadCount,
-		seeds:         seeds,
-		taskManager:   &sync.WaitGroup{},
-		tasks:         make(chan *task, taskQueueLength),
-		fetcher:       fetcher,
-		outputer:      outputer,
+func NewCrawler(cfg conf.CrawlerConf, seeds []string, fetcher Fetcher, outputer Outputer, robots Robots, checkpoint Checkpoint, scope Scope) *Crawler {
+	var revisit *revisitTable
+	if cfg.Daemon {
+		revisit = newRevisitTable(time.Duration(cfg.MinRevisitInterval)*time.Second, time.Duration(cfg.MaxRevisitInterval)*time.Second)
 	}
+
+	c := &Crawler{
+		maxDepth:    cfg.MaxDepth,
+		threadCount: cfg.ThreadCount,
+
+		linkExtractors: cfg.LinkExtractor,
+
+		obeyNofollow: cfg.ObeyNofollow,
+		obeyNoindex:  cfg.ObeyNoindex,
+
+		canonicalizer: canonicalizer.NewCanonicalizer(cfg.SortQuery, cfg.DropQueryParam),
+		visitedCfg:    cfg,
+
+		recrawlInterval: time.Duration(cfg.RecrawlInterval) * time.Second,
+		revisit:         revisit,
+
+		seeds:       seeds,
+		taskManager: &sync.WaitGroup{},
+		scheduler:   newScheduler(cfg),
+		routines:    &sync.WaitGroup{},
+		fetcher:     fetcher,
+		outputer:    outputer,
+		robots:      robots,
+		checkpoint:  checkpoint,
+		scope:       scope,
+	}
+
+	// lost tasks are never crawled, they are still pending in checkpoint
+	c.scheduler.lost = func(n int) {
+		for i := 0; i < n; i++ {
+			c.taskManager.Done()
+		}
+	}
+
+	return c
 }
 
 // Run crawler once.
-func (c *Crawler) RunOnce() error {
+// Returns when all tasks are done, or ctx is done. In both cases,
+// no goroutine started by crawler is left behind.
+func (c *Crawler) RunOnce(ctx context.Context) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+	defer c.release()
+
+	c.initTasks(true)
+
+	c.startWorkers(ctx)
+
+	c.taskManager.Wait()
+
+	c.stopWorkers()
+
+	return ctx.Err()
+}
+
+// Check config, build link extractors and visited set before running.
+func (c *Crawler) prepare() error {
 	if c.maxDepth < 0 {
 		return fmt.Errorf("maxDepth should >= 0, but got: %d", c.maxDepth)
 	}
 
-	c.initTasks()
+	extractors, err := parser.NewExtractors(c.linkExtractors)
+	if err != nil {
+		return fmt.Errorf("parser.NewExtractors(): %v", err)
+	}
+	if c.obeyNofollow {
+		extractors = extractors.WithoutNofollow()
+	}
+	c.extractors = extractors
+
+	fetchedURL, err := visited.NewSet(c.visitedCfg)
+	if err != nil {
+		return fmt.Errorf("visited.NewSet(): %v", err)
+	}
+	c.fetchedURL = fetchedURL
+
+	return nil
+}
+
+// Release resources created by c.prepare().
+func (c *Crawler) release() {
+	c.scheduler.close()
+
+	if err := c.fetchedURL.Close(); err != nil {
+		log.Logger.Warn("release(): fetchedURL.Close(): %v", err)
+	}
+}
+
+// Start c.threadCount goroutines to crawl, they exit when c.stopWorkers() is called.
+// Tasks are dropped rather than crawled once ctx is done, so that c.taskManager.Wait()
+// returns soon after cancellation.
+func (c *Crawler) startWorkers(ctx context.Context) {
+	c.finished = make(chan struct{})
 
-	// crawl
 	for i := 0; i < c.threadCount; i++ {
-		go c.crawl()
+		c.routines.Add(1)
+		go c.crawl(ctx)
 	}
+}
 
-	c.taskManager.Wait()
+// Make all goroutines started by crawler exit, and wait for them.
+func (c *Crawler) stopWorkers() {
+	close(c.finished)
+	c.routines.Wait()
+}
 
-	return nil
+// Add seeds to tasks, or pending tasks of last run if resume and there is a checkpoint.
+// In daemon mode, URLs due for revisiting are added along with seeds.
+func (c *Crawler) initTasks(resume bool) {
+	var initial []task
+	resumed := false
+
+	if resume {
+		initial, resumed = c.resumeTasks()
+	}
+
+	if !resumed {
+		initial = c.seedTasks()
+		initial = append(initial, c.revisitTasks(initial)...)
+	}
+
+	c.taskManager.Add(len(initial))
+
+	for _, t := range initial {
+		c.addTask(t)
+	}
 }
 
-// Add seeds to tasks.
-func (c *Crawler) initTasks() {
-	// parsed all seeds into *url.URL, filter out invalid ones
-	validSeeds := []*url.URL{}
+// Parse all seeds into tasks, filter out invalid ones.
+func (c *Crawler) seedTasks() []task {
+	tasks := []task{}
 	for _, seed := range c.seeds {
 		parsedURL, err := url.Parse(seed)
 		if err != nil {
-			log.Logger.Error("initTasks(): url: %s, url.Parse(): %v", seed, err)
+			log.Logger.Error("seedTasks(): url: %s, url.Parse(): %v", seed, err)
+			continue
+		}
+
+		if !c.inScope(parsedURL) {
+			log.Logger.Warn("seedTasks(): url: %s is out of scope", seed)
+			continue
+		}
+
+		// drop equivalent seeds
+		if !c.markFetched(parsedURL) {
+			continue
+		}
+
+		c.recordAdd(parsedURL.String(), c.maxDepth)
+		tasks = append(tasks, task{url: parsedURL, depth: c.maxDepth})
+	}
+
+	return tasks
+}
+
+// Get tasks due for revisiting, seeds are always due.
+func (c *Crawler) revisitTasks(seedTasks []task) []task {
+	if c.revisit == nil {
+		return nil
+	}
+
+	for _, t := range seedTasks {
+		c.revisit.expire(t.url.String())
+	}
+
+	tasks := []task{}
+	for uStr, depth := range c.revisit.dueTasks(time.Now()) {
+		parsedURL, err := url.Parse(uStr)
+		if err != nil {
+			log.Logger.Error("revisitTasks(): url: %s, url.Parse(): %v", uStr, err)
+			continue
+		}
+
+		// seeds are added already
+		if !c.markFetched(parsedURL) {
 			continue
 		}
 
-		validSeeds = append(validSeeds, parsedURL)
+		c.recordAdd(parsedURL.String(), depth)
+		tasks = append(tasks, task{url: parsedURL, depth: depth})
 	}
 
-	var syncSeeds []*url.URL  // save seeds should add to tasks synchronously
-	var asyncSeeds []*url.URL // save seeds should add to tasks asynchronously
+	return tasks
+}
 
-	if len(validSeeds) > taskQueueLength {
-		syncSeeds = validSeeds[:taskQueueLength]
-		asyncSeeds = validSeeds[taskQueueLength:]
-		log.Logger.Warn("initTasks(): length of valid seeds(%d) > taskQueueLength(%d), length of seeds: %d", len(validSeeds), taskQueueLength, len(c.seeds))
-	} else {
-		syncSeeds = validSeeds
+// Load tasks and visited URLs from checkpoint.
+// Returns false if there is nothing to resume.
+func (c *Crawler) resumeTasks() ([]task, bool) {
+	if c.checkpoint == nil {
+		return nil, false
 	}
 
-	c.taskManager.Add(len(validSeeds))
+	pending, visited, err := c.checkpoint.Load()
+	if err != nil {
+		log.Logger.Error("resumeTasks(): checkpoint.Load(): %v", err)
+		return nil, false
+	}
+
+	if len(pending) == 0 && len(visited) == 0 {
+		return nil, false
+	}
+
+	for _, u := range visited {
+		parsedURL, err := url.Parse(u)
+		if err != nil {
+			log.Logger.Error("resumeTasks(): url: %s, url.Parse(): %v", u, err)
+			continue
+		}
 
-	// add syncSeeds synchronously
-	for _, u := range syncSeeds {
-		c.addTask(task{u, c.maxDepth})
+		c.markFetched(parsedURL)
 	}
 
-	// add asyncSeeds asynchronously
-	if len(asyncSeeds) > 0 {
-		go c.addTasks(asyncSeeds, c.maxDepth)
+	tasks := []task{}
+	for _, p := range pending {
+		parsedURL, err := url.Parse(p.URL)
+		if err != nil {
+			log.Logger.Error("resumeTasks(): url: %s, url.Parse(): %v", p.URL, err)
+			continue
+		}
+
+		c.markFetched(parsedURL)
+		tasks = append(tasks, task{url: parsedURL, depth: p.Depth})
 	}
+
+	log.Logger.Info("resumeTasks(): resume %d pending tasks, %d visited URLs", len(tasks), len(visited))
+
+	return tasks, true
 }
 
-// Productor for c.tasks queue, add one task.
-func (c *Crawler) addTask(task task) {
-	c.tasks <- &task
+// Add one task to scheduler, never blocks.
+func (c *Crawler) addTask(t task) {
+	c.scheduler.push(&t)
 }
 
-// Productor for c.tasks queue, add mutiple tasks.
-func (c *Crawler) addTasks(urls []*url.URL, depth int) {
-	for _, url := range urls {
-		c.addTask(task{url, depth})
+// Consumer of scheduler, deals tasks dispatched by scheduler until c.finished is closed.
+// Further tasks found while crawling are added to scheduler.
+func (c *Crawler) crawl(ctx context.Context) {
+	defer c.routines.Done()
+
+	for {
+		t := c.scheduler.next(ctx, c.finished)
+		if t == nil {
+			return
+		}
+
+		// drop remaining tasks when ctx is done, they are still pending in checkpoint
+		var outcome fetchOutcome
+		if ctx.Err() == nil {
+			outcome = c.crawlTask(ctx, t)
+
+			// task interrupted by ctx, like cancelled while fetching, is left pending to be resumed
+			if ctx.Err() == nil {
+				c.recordDone(t.url.String())
+			}
+		}
+
+		c.scheduler.done(t, outcome)
+		c.taskManager.Done()
 	}
 }
 
-// Both consumer and productor for c.tasks queue.
-// As consumer, deals task in task queue.
-// As productor, adds further tasks to task queue asynchronously.
-func (c *Crawler) crawl() {
-	for {
-		t := <-c.tasks
-		u := t.url
-		uStr := u.String()
+// Fetch and output one task, add its further tasks.
+// Returns outcome of fetching, not fetched if the task is dropped before fetching, like disallowed by robots.txt.
+func (c *Crawler) crawlTask(ctx context.Context, t *task) fetchOutcome {
+	u := t.url
+	uStr := u.String()
 
-		log.Logger.Info("crawl(): start crawling %s", uStr)
+	log.Logger.Info("crawlTask(): start crawling %s", uStr)
 
-		c.limitFrequency(u.Host)
+	// obey robots.txt
+	if !c.robotsAllowed(ctx, u) {
+		return fetchOutcome{}
+	}
+
+	// skip URLs which are not due for revisiting
+	if c.revisit != nil && !c.revisit.due(uStr, time.Now()) {
+		log.Logger.Debug("crawlTask(): url: %s is not due for revisiting", uStr)
+		return fetchOutcome{}
+	}
+
+	start := time.Now()
+	fetchRes, err := c.fetcher.Fetch(ctx, uStr)
+	outcome := fetchOutcome{fetched: true, failed: hostFailed(err), latency: time.Since(start)}
+	if err != nil {
+		// crawl target of redirect not followed as a new link
+		var redirectErr *fetcher.RedirectError
+		if errors.As(err, &redirectErr) {
+			log.Logger.Info("crawlTask(): url: %s, %v", uStr, redirectErr)
+			c.addRedirectTask(ctx, redirectErr.Location, t.depth)
+			return outcome
+		}
 
-		fetchRes, err := c.fetcher.Fetch(uStr)
+		log.Logger.Error("crawlTask(): fetch url failed: %s, fetcher.Fetch(): %v", uStr, err)
+		return outcome
+	}
+
+	// final URL is the base of relative links, and is deduplicated too
+	base := u
+	if fetchRes.FinalURL != uStr {
+		finalURL, err := url.Parse(fetchRes.FinalURL)
 		if err != nil {
-			log.Logger.Error("crawl(): fetch url failed: %s, fetcher.Fetch(): %v", uStr, err)
-			c.taskManager.Done()
-			continue
-		} else {
-			// output to file
-			err := c.outputer.OutputFile(url.QueryEscape(uStr), fetchRes)
-			if err != nil {
-				log.Logger.Warn("crawl(): write url: %s to file failed, outputer.Output(): %v", uStr, err)
-			}
+			log.Logger.Error("crawlTask(): url: %s, url.Parse(): %v", fetchRes.FinalURL, err)
+			return outcome
+		}
+
+		log.Logger.Info("crawlTask(): url: %s redirected to %s", uStr, fetchRes.FinalURL)
+
+		// redirect followed may leave scope, or land on a path disallowed
+		if !c.inScope(finalURL) {
+			log.Logger.Info("crawlTask(): url: %s is out of scope, not output", fetchRes.FinalURL)
+			return outcome
+		}
+		if !c.robotsAllowed(ctx, finalURL) {
+			return outcome
+		}
+
+		if !c.markFetched(finalURL) {
+			log.Logger.Info("crawlTask(): url: %s is fetched already", fetchRes.FinalURL)
+			return outcome
 		}
 
-		// parse html
-		r := bytes.NewReader(fetchRes)
-		node, err := html.Parse(r)
+		base = finalURL
+	}
+
+	// neither output nor parse unchanged content
+	if c.revisit != nil && !c.revisit.update(uStr, t.depth, fetchRes.Body, time.Now()) {
+		log.Logger.Info("crawlTask(): url: %s is unchanged", uStr)
+		return outcome
+	}
+
+	// parse html only, other media types are output without links extracted
+	var node *html.Node
+	if isHTML(fetchRes.ContentType) {
+		node, err = html.Parse(bytes.NewReader(fetchRes.Body))
 		if err != nil {
-			log.Logger.Error("crawl(): url: %s, html.Parse(): %v", t.url, err)
-		}
-
-		// get deeper URLs
-		deeperURLs := []*url.URL{}
-		parser.Parse(node, u, &deeperURLs)
-
-		// add further tasks
-		depth := t.depth - 1
-		if depth >= 0 && len(deeperURLs) > 0 {
-			for _, url := range deeperURLs {
-				furtherTask := task{url, depth}
-				if _, exist := c.fetchedURL.LoadOrStore(url.String(), true); !exist {
-					c.taskManager.Add(1)
-					go c.addTask(furtherTask)
-				}
+			log.Logger.Error("crawlTask(): url: %s, html.Parse(): %v", t.url, err)
+			node = nil
+		}
+	} else {
+		log.Logger.Debug("crawlTask(): url: %s, media type: %s is not parsed", uStr, fetchRes.ContentType)
+	}
+
+	var directives parser.Directives
+	if node != nil {
+		directives = parser.MetaRobots(node)
+	}
+
+	// output to file, not modified one is output unless saved already, like output directory is wiped
+	fileName := url.QueryEscape(base.String())
+	if c.obeyNoindex && directives.NoIndex {
+		log.Logger.Info("crawlTask(): url: %s is noindex, not output", uStr)
+	} else if fetchRes.NotModified && c.saved(fileName, fetchRes) {
+		log.Logger.Info("crawlTask(): url: %s is not modified, not output", uStr)
+	} else {
+		err = c.outputer.OutputFile(fileName, fetchRes)
+		if err != nil {
+			log.Logger.Warn("crawlTask(): write url: %s to file failed, outputer.Output(): %v", uStr, err)
+		}
+	}
+
+	if node == nil {
+		return outcome
+	}
+
+	if c.obeyNofollow && directives.NoFollow {
+		log.Logger.Info("crawlTask(): url: %s is nofollow, links not followed", uStr)
+		return outcome
+	}
+
+	// get deeper URLs
+	deeperURLs := []*url.URL{}
+	parser.Parse(node, base, c.extractors, &deeperURLs)
+
+	// add further tasks
+	depth := t.depth - 1
+	if depth >= 0 && len(deeperURLs) > 0 && ctx.Err() == nil {
+		for _, url := range deeperURLs {
+			if c.inScope(url) && c.markFetched(url) {
+				c.addFurtherTask(task{url: url, depth: depth})
 			}
 		}
+	}
 
-		c.taskManager.Done()
+	return outcome
+}
+
+// Check whether u is allowed by robots.txt, and raise crawl interval of u's host by its Crawl-delay.
+// All are allowed if robots.txt is not obeyed.
+func (c *Crawler) robotsAllowed(ctx context.Context, u *url.URL) bool {
+	if c.robots == nil {
+		return true
+	}
+
+	allowed, crawlDelay := c.robots.Allowed(ctx, u)
+	if !allowed {
+		log.Logger.Info("robotsAllowed(): url: %s disallowed by robots.txt", u.String())
+		return false
 	}
+
+	c.scheduler.raiseInterval(u, crawlDelay)
+
+	return true
 }
 
-// TODO: Optimize efficiency for limitFrequency(), at present, c.crawl() will hang out when c.limitFrequency() failed.
-// Limit fetch frequency for host by tokenBucket.
-func (c *Crawler) limitFrequency(host string) {
-	t, ok := c.frequencyLimiter.LoadOrStore(host, make(hostTokenBucket))
-	if !ok {
-		// issue a token for host circularly by c.crawlInterval
-		go issueTokenCircularly(t.(hostTokenBucket), c.crawlInterval)
+// Check whether res is saved by outputer already, true if outputer can not tell.
+func (c *Crawler) saved(fileName string, res *fetcher.FetchResult) bool {
+	checker, ok := c.outputer.(SavedChecker)
+
+	return !ok || checker.Saved(fileName, res)
+}
+
+// Add target of a redirect not followed as a task of the same depth.
+func (c *Crawler) addRedirectTask(ctx context.Context, location string, depth int) {
+	u, err := url.Parse(location)
+	if err != nil {
+		log.Logger.Warn("addRedirectTask(): url: %s, url.Parse(): %v", location, err)
+		return
 	}
 
-	// get token
-	getToken(t.(hostTokenBucket))
+	if ctx.Err() == nil && c.inScope(u) && c.markFetched(u) {
+		c.addFurtherTask(task{url: u, depth: depth})
+	}
 }
 
-func issueTokenCircularly(tb hostTokenBucket, interval int) {
-	for {
-		tb <- true
-		time.Sleep(time.Second * time.Duration(interval))
+// Add a task found while crawling.
+func (c *Crawler) addFurtherTask(t task) {
+	c.recordAdd(t.url.String(), t.depth)
+	c.taskManager.Add(1)
+	c.addTask(t)
+}
+
+// Check whether err shows host failed to serve, like timeout or overloaded.
+func hostFailed(err error) bool {
+	var statusErr *fetcher.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	var timeoutErr *fetcher.TimeoutError
+	var networkErr *fetcher.NetworkError
+
+	return errors.As(err, &timeoutErr) || errors.As(err, &networkErr)
+}
+
+// Check whether media type can be parsed as html, unknown media type is tried as html.
+func isHTML(mediaType string) bool {
+	switch mediaType {
+	case "", "text/html", "application/xhtml+xml":
+		return true
+	default:
+		return false
+	}
+}
+
+// Check whether u is in scope of crawler.
+func (c *Crawler) inScope(u *url.URL) bool {
+	return c.scope == nil || c.scope.InScope(u)
+}
+
+// Mark u as fetched, by its canonical form.
+// Returns false if u or an equivalent URL is fetched already.
+func (c *Crawler) markFetched(u *url.URL) bool {
+	key := c.canonicalizer.Canonicalize(u).String()
+	added, err := c.fetchedURL.Add(key)
+	if err != nil {
+		// treat as fetched, rather than fetch it again and again
+		log.Logger.Error("markFetched(): url: %s, fetchedURL.Add(): %v", key, err)
+		return false
 	}
+
+	visitedURLs.Set(float64(c.fetchedURL.Len()))
+
+	return added
 }
 
-func getToken(tb hostTokenBucket) {
-	<-tb
+// Record a task added into checkpoint.
+func (c *Crawler) recordAdd(url string, depth int) {
+	if c.checkpoint == nil {
+		return
+	}
+
+	if err := c.checkpoint.Add(url, depth); err != nil {
+		log.Logger.Warn("recordAdd(): url: %s, checkpoint.Add(): %v", url, err)
+	}
+}
+
+// Record a task finished into checkpoint.
+func (c *Crawler) recordDone(url string) {
+	if c.checkpoint == nil {
+		return
+	}
+
+	if err := c.checkpoint.Done(url); err != nil {
+		log.Logger.Warn("recordDone(): url: %s, checkpoint.Done(): %v", url, err)
+	}
 }
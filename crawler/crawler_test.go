@@ -3,11 +3,18 @@
 package crawler
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,7 +22,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/html"
 
+	"github.com/NKztq/spider/checkpoint"
 	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
 	"github.com/NKztq/spider/parser"
 )
 
@@ -27,17 +36,43 @@ type mockOutputer struct {
 	outputDirectory string
 }
 
-func (m *mockFetcher) Fetch(url string) ([]byte, error) {
+// implement for Robots
+type mockRobots struct {
+	disallowed map[string]bool
+}
+
+// implement for Scope
+type mockScope struct {
+	outOfScope map[string]bool
+}
+
+// implement for Checkpoint
+type mockCheckpoint struct {
+	pending []checkpoint.Task
+	visited []string
+
+	lock  sync.Mutex
+	added []string
+	done  []string
+}
+
+// Get result of url fetched without redirect.
+func newFetchResult(url string, body []byte) *fetcher.FetchResult {
+	return &fetcher.FetchResult{URL: url, FinalURL: url, StatusCode: 200, ContentType: "text/html", Body: body}
+}
+
+func (m *mockFetcher) Fetch(ctx context.Context, url string) (*fetcher.FetchResult, error) {
 	ret := map[string][]byte{
 		"http://www.baidu.com":  []byte("test"),
 		"http://www.baidu1.com": []byte("test1"),
 		"http://www.baidu2.com": []byte("test2"),
+		"http://www.baidu3.com": []byte(`<html><head><meta name="robots" content="noindex,nofollow"></head></html>`),
 	}
 
-	return ret[url], nil
+	return newFetchResult(url, ret[url]), nil
 }
 
-func (m *mockOutputer) OutputFile(fileName string, content []byte) error {
+func (m *mockOutputer) OutputFile(fileName string, res *fetcher.FetchResult) error {
 	if _, err := os.Stat(m.outputDirectory); os.IsNotExist(err) {
 		os.Mkdir(m.outputDirectory, os.ModePerm)
 	}
@@ -45,13 +80,87 @@ func (m *mockOutputer) OutputFile(fileName string, content []byte) error {
 	f, _ := os.Create(path.Join(m.outputDirectory, fileName))
 	defer f.Close()
 
-	f.Write(content)
+	f.Write(res.Body)
 
 	return nil
 }
 
+func (m *mockRobots) Allowed(ctx context.Context, u *url.URL) (bool, time.Duration) {
+	return !m.disallowed[u.String()], 0
+}
+
+func (m *mockScope) InScope(u *url.URL) bool {
+	return !m.outOfScope[u.String()]
+}
+
+func (m *mockCheckpoint) Load() ([]checkpoint.Task, []string, error) {
+	return m.pending, m.visited, nil
+}
+
+func (m *mockCheckpoint) Add(url string, depth int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.added = append(m.added, url)
+	return nil
+}
+
+func (m *mockCheckpoint) Done(url string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.done = append(m.done, url)
+	return nil
+}
+
+// implement for Fetcher, redirects URLs by redirects
+type redirectingFetcher struct {
+	redirects   map[string]string // URL => URL redirected to and followed
+	notFollowed map[string]string // URL => URL redirected to but not followed
+	countingFetcher
+}
+
+func (m *redirectingFetcher) Fetch(ctx context.Context, url string) (*fetcher.FetchResult, error) {
+	if location, ok := m.notFollowed[url]; ok {
+		m.countingFetcher.Fetch(ctx, url)
+		return nil, &fetcher.RedirectError{URL: url, Location: location, CrossHost: true}
+	}
+
+	if location, ok := m.redirects[url]; ok {
+		res, err := m.countingFetcher.Fetch(ctx, url)
+		res.FinalURL = location
+		res.Redirects = []fetcher.Redirect{{URL: url, StatusCode: 301}}
+		return res, err
+	}
+
+	return m.countingFetcher.Fetch(ctx, url)
+}
+
+// implement for Fetcher, blocks until ctx is done
+type blockingFetcher struct{}
+
+func (m *blockingFetcher) Fetch(ctx context.Context, url string) (*fetcher.FetchResult, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// Check that goroutines started after before was counted have exited.
+func assertNoGoroutineLeak(t *testing.T, before int) {
+	// goroutines may be still returning after their WaitGroup.Done()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	after := runtime.NumGoroutine()
+	if after > before {
+		buf := make([]byte, 1<<20)
+		t.Errorf("goroutine leak: %d before, %d after\n%s", before, after, buf[:runtime.Stack(buf, true)])
+	}
+}
+
 func TestRunOnce(t *testing.T) {
-	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, d *[]*url.URL) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
 		u1, _ := url.Parse("http://www.baidu1.com")
 		u2, _ := url.Parse("http://www.baidu2.com")
 		*d = append(*d, u1)
@@ -64,7 +173,7 @@ func TestRunOnce(t *testing.T) {
 	// param
 	cfg := conf.CrawlerConf{
 		MaxDepth:      1,
-		CrawlInterval: 1,
+		CrawlInterval: conf.Duration(time.Second),
 		ThreadCount:   8,
 	}
 	seeds := []string{"http://www.baidu.com"}
@@ -72,10 +181,12 @@ func TestRunOnce(t *testing.T) {
 	outputer := &mockOutputer{outputDirectory}
 
 	// new
-	crawler := NewCrawler(cfg, seeds, fetcher, outputer)
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, nil, nil)
 
 	// run
-	crawler.RunOnce()
+	before := runtime.NumGoroutine()
+	assert.NoError(t, crawler.RunOnce(context.Background()))
+	assertNoGoroutineLeak(t, before)
 
 	// should crawl www.baidu.com, www.baidu1.com, www.baidu2.com
 	data, err := ioutil.ReadFile("./testoutput/http%3A%2F%2Fwww.baidu.com")
@@ -93,7 +204,7 @@ func TestRunOnce(t *testing.T) {
 }
 
 func TestRunOnce_DepthZero(t *testing.T) {
-	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, d *[]*url.URL) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
 		u1, _ := url.Parse("http://www.baidu1.com")
 		u2, _ := url.Parse("http://www.baidu2.com")
 		*d = append(*d, u1)
@@ -106,7 +217,7 @@ func TestRunOnce_DepthZero(t *testing.T) {
 	// param
 	cfg := conf.CrawlerConf{
 		MaxDepth:      0,
-		CrawlInterval: 1,
+		CrawlInterval: conf.Duration(time.Second),
 		ThreadCount:   8,
 	}
 	seeds := []string{"http://www.baidu.com"}
@@ -114,10 +225,10 @@ func TestRunOnce_DepthZero(t *testing.T) {
 	outputer := &mockOutputer{outputDirectory}
 
 	// new
-	crawler := NewCrawler(cfg, seeds, fetcher, outputer)
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, nil, nil)
 
 	// run
-	crawler.RunOnce()
+	crawler.RunOnce(context.Background())
 
 	// should only crawl www.baidu.com
 	data, err := ioutil.ReadFile("./testoutput1/http%3A%2F%2Fwww.baidu.com")
@@ -132,8 +243,8 @@ func TestRunOnce_DepthZero(t *testing.T) {
 	assert.NoError(t, os.RemoveAll(outputDirectory))
 }
 
-func TestLimitFrequency(t *testing.T) {
-	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, d *[]*url.URL) {
+func TestRunOnce_CrawlInterval(t *testing.T) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
 		u1, _ := url.Parse("http://www.baidu1.com")
 		u2, _ := url.Parse("http://www.baidu2.com")
 		*d = append(*d, u1)
@@ -146,7 +257,7 @@ func TestLimitFrequency(t *testing.T) {
 	// param
 	cfg := conf.CrawlerConf{
 		MaxDepth:      1,
-		CrawlInterval: 2,
+		CrawlInterval: conf.Duration(2 * time.Second),
 		ThreadCount:   8,
 	}
 	seeds := []string{"http://www.baidu1.com/test.html"}
@@ -154,14 +265,14 @@ func TestLimitFrequency(t *testing.T) {
 	outputer := &mockOutputer{outputDirectory}
 
 	// new
-	crawler := NewCrawler(cfg, seeds, fetcher, outputer)
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, nil, nil)
 
 	now := time.Now().Unix()
-	crawler.RunOnce()
+	crawler.RunOnce(context.Background())
 	after := time.Now().Unix()
 
 	if after-now < 2 {
-		t.Errorf("limitFrequency failed")
+		t.Errorf("crawl interval not respected")
 	}
 
 	// delete testoutput
@@ -169,13 +280,7 @@ func TestLimitFrequency(t *testing.T) {
 }
 
 func TestRunOnce_ShortTaskQueue(t *testing.T) {
-	mem := taskQueueLength
-	taskQueueLength = 1
-	defer func() {
-		taskQueueLength = mem
-	}()
-
-	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, d *[]*url.URL) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
 		u1, _ := url.Parse("http://www.baidu1.com")
 		u2, _ := url.Parse("http://www.baidu2.com")
 		*d = append(*d, u1)
@@ -184,22 +289,29 @@ func TestRunOnce_ShortTaskQueue(t *testing.T) {
 	defer guard.Unpatch()
 
 	outputDirectory := "./testoutput3"
+	frontierDirectory := "./testfrontier3"
+	assert.NoError(t, os.MkdirAll(frontierDirectory, os.ModePerm))
+	defer os.RemoveAll(frontierDirectory)
 
-	// param
+	// param, tasks beyond the first are spilled to disk
 	cfg := conf.CrawlerConf{
-		MaxDepth:      1,
-		CrawlInterval: 1,
-		ThreadCount:   8,
+		MaxDepth:           1,
+		CrawlInterval:      conf.Duration(time.Second),
+		ThreadCount:        8,
+		FrontierMemorySize: 1,
+		FrontierDirectory:  frontierDirectory,
 	}
 	seeds := []string{"http://www.baidu.com", "http://www.baidu1.com"}
 	fetcher := &mockFetcher{}
 	outputer := &mockOutputer{outputDirectory}
 
 	// new
-	crawler := NewCrawler(cfg, seeds, fetcher, outputer)
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, nil, nil)
 
 	// run
-	crawler.RunOnce()
+	before := runtime.NumGoroutine()
+	assert.NoError(t, crawler.RunOnce(context.Background()))
+	assertNoGoroutineLeak(t, before)
 
 	// should crawl www.baidu.com, www.baidu1.com, www.baidu2.com
 	data, err := ioutil.ReadFile("./testoutput3/http%3A%2F%2Fwww.baidu.com")
@@ -212,6 +324,745 @@ func TestRunOnce_ShortTaskQueue(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("test2"), data2)
 
+	// spill file is removed
+	files, err := ioutil.ReadDir(frontierDirectory)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+
 	// delete testoutput
 	assert.NoError(t, os.RemoveAll(outputDirectory))
 }
+
+func TestRunOnce_SpillCorrupted(t *testing.T) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		for _, rawURL := range []string{"http://www.baidu1.com", "http://www.baidu2.com", "http://www.baidu3.com"} {
+			u, _ := url.Parse(rawURL)
+			*d = append(*d, u)
+		}
+	})
+	defer guard.Unpatch()
+
+	outputDirectory := "./testoutput10"
+	defer func() {
+		// delete testoutput
+		assert.NoError(t, os.RemoveAll(outputDirectory))
+	}()
+
+	frontierDirectory, err := ioutil.TempDir("", "frontier")
+	assert.NoError(t, err)
+	defer os.RemoveAll(frontierDirectory)
+
+	// param, tasks beyond the first are spilled to disk
+	cfg := conf.CrawlerConf{
+		MaxDepth:           1,
+		CrawlInterval:      conf.Duration(time.Millisecond),
+		ThreadCount:        1,
+		FrontierMemorySize: 1,
+		FrontierDirectory:  frontierDirectory,
+	}
+	seeds := []string{"http://www.baidu.com"}
+	fetcher := &mockFetcher{}
+	outputer := &mockOutputer{outputDirectory}
+	cp := &mockCheckpoint{}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, cp, nil)
+
+	// spill file is read only, so spilled tasks are lost once flushed
+	spillFile, err := ioutil.TempFile(frontierDirectory, "frontier-*.spill")
+	assert.NoError(t, err)
+	assert.NoError(t, spillFile.Close())
+	crawler.scheduler.spill.file, err = os.Open(spillFile.Name())
+	assert.NoError(t, err)
+	crawler.scheduler.spill.writer = bufio.NewWriter(crawler.scheduler.spill.file)
+
+	// run, lost tasks should not block RunOnce
+	result := make(chan error, 1)
+	go func() {
+		result <- crawler.RunOnce(context.Background())
+	}()
+
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunOnce() blocked by lost spilled tasks")
+	}
+
+	// lost tasks are still pending in checkpoint
+	assert.Len(t, cp.added, 4)
+	assert.Len(t, cp.done, 2)
+}
+
+func TestRunOnce_RobotsDisallowed(t *testing.T) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		u1, _ := url.Parse("http://www.baidu1.com")
+		u2, _ := url.Parse("http://www.baidu2.com")
+		*d = append(*d, u1)
+		*d = append(*d, u2)
+	})
+	defer guard.Unpatch()
+
+	outputDirectory := "./testoutput4"
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   8,
+	}
+	seeds := []string{"http://www.baidu.com"}
+	fetcher := &mockFetcher{}
+	outputer := &mockOutputer{outputDirectory}
+	robots := &mockRobots{map[string]bool{"http://www.baidu2.com": true}}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, robots, nil, nil)
+
+	// run
+	crawler.RunOnce(context.Background())
+
+	// should crawl www.baidu.com, www.baidu1.com, but not www.baidu2.com
+	data, err := ioutil.ReadFile("./testoutput4/http%3A%2F%2Fwww.baidu.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("test"), data)
+	data1, err := ioutil.ReadFile("./testoutput4/http%3A%2F%2Fwww.baidu1.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("test1"), data1)
+	_, err = ioutil.ReadFile("./testoutput4/http%3A%2F%2Fwww.baidu2.com")
+	assert.True(t, strings.Contains(err.Error(), "no such file or directory"))
+
+	// delete testoutput
+	assert.NoError(t, os.RemoveAll(outputDirectory))
+}
+
+func TestRunOnce_Checkpoint(t *testing.T) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		u1, _ := url.Parse("http://www.baidu1.com")
+		u2, _ := url.Parse("http://www.baidu2.com")
+		*d = append(*d, u1)
+		*d = append(*d, u2)
+	})
+	defer guard.Unpatch()
+
+	outputDirectory := "./testoutput5"
+	defer func() {
+		// delete testoutput
+		assert.NoError(t, os.RemoveAll(outputDirectory))
+	}()
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   8,
+	}
+	seeds := []string{"http://www.baidu.com"}
+	fetcher := &mockFetcher{}
+	outputer := &mockOutputer{outputDirectory}
+	cp := &mockCheckpoint{}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, cp, nil)
+
+	// run
+	crawler.RunOnce(context.Background())
+
+	// every task should be recorded as added and done
+	expectURLs := []string{"http://www.baidu.com", "http://www.baidu1.com", "http://www.baidu2.com"}
+	assert.ElementsMatch(t, expectURLs, cp.added)
+	assert.ElementsMatch(t, expectURLs, cp.done)
+}
+
+func TestRevisitTasks_Checkpoint(t *testing.T) {
+	cfg := conf.CrawlerConf{
+		MaxDepth:           1,
+		ThreadCount:        8,
+		Daemon:             true,
+		MinRevisitInterval: 60,
+		MaxRevisitInterval: 3600,
+	}
+	seeds := []string{"http://www.baidu.com"}
+	cp := &mockCheckpoint{}
+
+	crawler := NewCrawler(cfg, seeds, &mockFetcher{}, &mockOutputer{}, nil, cp, nil)
+	assert.NoError(t, crawler.prepare())
+	defer crawler.release()
+
+	// both visited an hour ago, so due now
+	visitTime := time.Now().Add(-time.Hour)
+	crawler.revisit.update("http://www.baidu.com", 1, []byte("test"), visitTime)
+	crawler.revisit.update("http://www.baidu1.com", 0, []byte("test1"), visitTime)
+
+	tasks := crawler.revisitTasks(crawler.seedTasks())
+
+	// revisited tasks should be recorded as added, like seeds
+	assert.Equal(t, 1, len(tasks))
+	assert.ElementsMatch(t, []string{"http://www.baidu.com", "http://www.baidu1.com"}, cp.added)
+}
+
+func TestRunOnce_Resume(t *testing.T) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		u1, _ := url.Parse("http://www.baidu1.com")
+		u2, _ := url.Parse("http://www.baidu2.com")
+		*d = append(*d, u1)
+		*d = append(*d, u2)
+	})
+	defer guard.Unpatch()
+
+	outputDirectory := "./testoutput6"
+	defer func() {
+		// delete testoutput
+		assert.NoError(t, os.RemoveAll(outputDirectory))
+	}()
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   8,
+	}
+	seeds := []string{"http://www.baidu.com"}
+	fetcher := &mockFetcher{}
+	outputer := &mockOutputer{outputDirectory}
+	cp := &mockCheckpoint{
+		pending: []checkpoint.Task{{URL: "http://www.baidu1.com", Depth: 0}},
+		visited: []string{"http://www.baidu.com"},
+	}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, cp, nil)
+
+	// run
+	crawler.RunOnce(context.Background())
+
+	// should only crawl pending www.baidu1.com, not seeds
+	_, err := ioutil.ReadFile("./testoutput6/http%3A%2F%2Fwww.baidu.com")
+	assert.True(t, strings.Contains(err.Error(), "no such file or directory"))
+	data1, err := ioutil.ReadFile("./testoutput6/http%3A%2F%2Fwww.baidu1.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("test1"), data1)
+	_, err = ioutil.ReadFile("./testoutput6/http%3A%2F%2Fwww.baidu2.com")
+	assert.True(t, strings.Contains(err.Error(), "no such file or directory"))
+
+	assert.Empty(t, cp.added)
+	assert.Equal(t, []string{"http://www.baidu1.com"}, cp.done)
+}
+
+func TestRunOnce_Cancel(t *testing.T) {
+	outputDirectory := "./testoutput7"
+	defer func() {
+		// delete testoutput
+		assert.NoError(t, os.RemoveAll(outputDirectory))
+	}()
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   2,
+	}
+	seeds := []string{"http://www.baidu.com", "http://www.baidu1.com", "http://www.baidu2.com", "http://www.baidu3.com", "http://www.baidu4.com"}
+	fetcher := &blockingFetcher{}
+	outputer := &mockOutputer{outputDirectory}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// run
+	before := runtime.NumGoroutine()
+	start := time.Now()
+	err := crawler.RunOnce(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+	assertNoGoroutineLeak(t, before)
+
+	// nothing fetched
+	_, err = os.Stat(outputDirectory)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunOnce_CancelWhileFetching(t *testing.T) {
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   2,
+	}
+	seeds := []string{"http://www.baidu.com"}
+	fetcher := &blockingFetcher{}
+	outputer := &mockOutputer{"./testoutput7"}
+	cp := &mockCheckpoint{}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, cp, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// run
+	err := crawler.RunOnce(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// seed is never fetched, so it is still pending to be resumed
+	assert.Equal(t, []string{"http://www.baidu.com"}, cp.added)
+	assert.Empty(t, cp.done)
+}
+
+func TestRunOnce_UnknownExtractor(t *testing.T) {
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   8,
+		LinkExtractor: []string{"a.href", "unknown.src"},
+	}
+
+	// new
+	crawler := NewCrawler(cfg, nil, &mockFetcher{}, &mockOutputer{}, nil, nil, nil)
+
+	err := crawler.RunOnce(context.Background())
+	assert.True(t, strings.Contains(err.Error(), "unknown extractor: unknown.src"))
+}
+
+func TestRunOnce_MetaRobots(t *testing.T) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		u1, _ := url.Parse("http://www.baidu1.com")
+		u2, _ := url.Parse("http://www.baidu2.com")
+		*d = append(*d, u1)
+		*d = append(*d, u2)
+	})
+	defer guard.Unpatch()
+
+	cases := []struct {
+		obeyNofollow bool
+		obeyNoindex  bool
+		expectFiles  []string
+	}{
+		{false, false, []string{"http%3A%2F%2Fwww.baidu1.com", "http%3A%2F%2Fwww.baidu2.com", "http%3A%2F%2Fwww.baidu3.com"}},
+		{false, true, []string{"http%3A%2F%2Fwww.baidu1.com", "http%3A%2F%2Fwww.baidu2.com"}},
+		{true, false, []string{"http%3A%2F%2Fwww.baidu3.com"}},
+		{true, true, []string{}},
+	}
+
+	for _, c := range cases {
+		// param
+		cfg := conf.CrawlerConf{
+			MaxDepth:      1,
+			CrawlInterval: conf.Duration(time.Second),
+			ThreadCount:   8,
+			ObeyNofollow:  c.obeyNofollow,
+			ObeyNoindex:   c.obeyNoindex,
+		}
+		// page of www.baidu3.com is noindex and nofollow
+		seeds := []string{"http://www.baidu3.com"}
+		fetcher := &mockFetcher{}
+		outputer := &countingOutputer{output: make(map[string]int)}
+
+		// new
+		crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, nil, nil)
+
+		// run
+		assert.NoError(t, crawler.RunOnce(context.Background()))
+
+		actualFiles := []string{}
+		for fileName := range outputer.output {
+			actualFiles = append(actualFiles, fileName)
+		}
+		assert.ElementsMatch(t, c.expectFiles, actualFiles, "nofollow: %v, noindex: %v", c.obeyNofollow, c.obeyNoindex)
+	}
+}
+
+func TestRunOnce_Canonicalize(t *testing.T) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		for _, rawURL := range []string{"http://www.baidu1.com/x#frag", "HTTP://WWW.BAIDU1.COM:80/./x", "http://www.baidu1.com/x?utm_source=baidu", "http://www.baidu1.com/x?b=2&a=1", "http://www.baidu1.com/x?a=1&b=2"} {
+			u, _ := url.Parse(rawURL)
+			*d = append(*d, u)
+		}
+	})
+	defer guard.Unpatch()
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:       1,
+		CrawlInterval:  conf.Duration(time.Second),
+		ThreadCount:    8,
+		SortQuery:      true,
+		DropQueryParam: []string{"utm_*"},
+	}
+	// equivalent seeds are crawled once
+	seeds := []string{"http://www.baidu.com", "http://WWW.baidu.com:80"}
+	fetcher := &countingFetcher{fetched: make(map[string]int)}
+	outputer := &countingOutputer{output: make(map[string]int)}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, nil, nil)
+
+	// run
+	assert.NoError(t, crawler.RunOnce(context.Background()))
+
+	// one of www.baidu.com seeds, http://www.baidu1.com/x and http://www.baidu1.com/x?a=1&b=2 in any form
+	fetched := 0
+	for _, count := range fetcher.fetched {
+		fetched += count
+	}
+	assert.Equal(t, 3, fetched)
+}
+
+func TestRunOnce_Scope(t *testing.T) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		u1, _ := url.Parse("http://www.baidu1.com")
+		u2, _ := url.Parse("http://www.baidu2.com")
+		*d = append(*d, u1)
+		*d = append(*d, u2)
+	})
+	defer guard.Unpatch()
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   8,
+	}
+	seeds := []string{"http://www.baidu.com", "http://www.baidu3.com"}
+	fetcher := &countingFetcher{fetched: make(map[string]int)}
+	outputer := &countingOutputer{output: make(map[string]int)}
+	scope := &mockScope{map[string]bool{"http://www.baidu2.com": true, "http://www.baidu3.com": true}}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, nil, scope)
+
+	// run
+	assert.NoError(t, crawler.RunOnce(context.Background()))
+
+	// out of scope seeds and further URLs are not crawled
+	assert.Equal(t, map[string]int{"http://www.baidu.com": 1, "http://www.baidu1.com": 1}, fetcher.fetched)
+}
+
+func TestRunOnce_VisitedSet(t *testing.T) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		u1, _ := url.Parse("http://www.baidu1.com")
+		u2, _ := url.Parse("http://www.baidu2.com")
+		*d = append(*d, u1)
+		*d = append(*d, u2)
+	})
+	defer guard.Unpatch()
+
+	directory := "./testvisited"
+	defer func() {
+		// delete visited set
+		assert.NoError(t, os.RemoveAll(directory))
+	}()
+
+	for _, visitedSet := range []string{"memory", "bloom", "disk"} {
+		// param
+		cfg := conf.CrawlerConf{
+			MaxDepth:               2,
+			CrawlInterval:          conf.Duration(time.Second),
+			ThreadCount:            8,
+			VisitedSet:             visitedSet,
+			BloomCapacity:          100,
+			BloomFalsePositiveRate: 0.001,
+			VisitedSetDirectory:    directory,
+		}
+		seeds := []string{"http://www.baidu.com"}
+		fetcher := &countingFetcher{fetched: make(map[string]int)}
+		outputer := &countingOutputer{output: make(map[string]int)}
+
+		// new
+		crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, nil, nil)
+
+		// run
+		assert.NoError(t, crawler.RunOnce(context.Background()))
+
+		// every URL is fetched once
+		assert.Equal(t, map[string]int{"http://www.baidu.com": 1, "http://www.baidu1.com": 1, "http://www.baidu2.com": 1}, fetcher.fetched, visitedSet)
+	}
+}
+
+func TestRunOnce_Redirect(t *testing.T) {
+	var lock sync.Mutex
+	bases := []string{}
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		bases = append(bases, u.String())
+		if u.String() == "http://www.baidu.com/home/" {
+			// relative link resolved against final URL
+			u1, _ := u.Parse("news.html")
+			*d = append(*d, u1)
+		}
+	})
+	defer guard.Unpatch()
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   8,
+	}
+	// the second seed redirects to the first one
+	seeds := []string{"http://www.baidu.com", "http://www.baidu.com/home/", "http://www.baidu1.com"}
+	fetcher := &redirectingFetcher{
+		redirects: map[string]string{
+			"http://www.baidu.com":  "http://www.baidu.com/home/",
+			"http://www.baidu1.com": "http://www.baidu.com/home/",
+		},
+		notFollowed:     map[string]string{},
+		countingFetcher: countingFetcher{fetched: make(map[string]int)},
+	}
+	outputer := &countingOutputer{output: make(map[string]int)}
+
+	// new
+	crawler := NewCrawler(cfg, seeds[:1], fetcher, outputer, nil, nil, nil)
+
+	// run
+	assert.NoError(t, crawler.RunOnce(context.Background()))
+
+	assert.Equal(t, []string{"http://www.baidu.com/home/"}, bases[:1])
+	assert.Equal(t, 1, fetcher.fetched["http://www.baidu.com/home/news.html"])
+	assert.Equal(t, 1, outputer.output[url.QueryEscape("http://www.baidu.com/home/")])
+
+	// final URL fetched already is neither output nor parsed
+	fetcher.fetched = make(map[string]int)
+	outputer.output = make(map[string]int)
+	bases = []string{}
+
+	crawler = NewCrawler(cfg, seeds[1:], fetcher, outputer, nil, nil, nil)
+	assert.NoError(t, crawler.RunOnce(context.Background()))
+
+	assert.Equal(t, 1, fetcher.fetched["http://www.baidu.com/home/"])
+	assert.Equal(t, 1, fetcher.fetched["http://www.baidu1.com"])
+	parsed := 0
+	for _, base := range bases {
+		if base == "http://www.baidu.com/home/" {
+			parsed++
+		}
+	}
+	assert.Equal(t, 1, parsed)
+	assert.Equal(t, 1, outputer.output[url.QueryEscape("http://www.baidu.com/home/")])
+}
+
+func TestRunOnce_RedirectNotFollowed(t *testing.T) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {})
+	defer guard.Unpatch()
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      0,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   8,
+	}
+	seeds := []string{"http://www.baidu.com", "http://www.baidu2.com"}
+	fetcher := &redirectingFetcher{
+		redirects: map[string]string{},
+		notFollowed: map[string]string{
+			"http://www.baidu.com":  "http://www.baidu1.com/",
+			"http://www.baidu2.com": "http://www.baidu3.com/",
+		},
+		countingFetcher: countingFetcher{fetched: make(map[string]int)},
+	}
+	scope := &mockScope{outOfScope: map[string]bool{"http://www.baidu3.com/": true}}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, fetcher, &countingOutputer{output: make(map[string]int)}, nil, nil, scope)
+
+	// run
+	assert.NoError(t, crawler.RunOnce(context.Background()))
+
+	// target is crawled at the same depth, if in scope
+	assert.Equal(t, 1, fetcher.fetched["http://www.baidu1.com/"])
+	assert.Equal(t, 0, fetcher.fetched["http://www.baidu3.com/"])
+}
+
+func TestRunOnce_RedirectOutOfScope(t *testing.T) {
+	var lock sync.Mutex
+	bases := []string{}
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		bases = append(bases, u.String())
+	})
+	defer guard.Unpatch()
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   8,
+	}
+	seeds := []string{"http://www.baidu.com", "http://www.baidu2.com", "http://www.baidu4.com"}
+	fetcher := &redirectingFetcher{
+		redirects: map[string]string{
+			"http://www.baidu.com":  "http://www.baidu1.com/",
+			"http://www.baidu2.com": "http://www.baidu3.com/",
+			"http://www.baidu4.com": "http://www.baidu5.com/",
+		},
+		notFollowed:     map[string]string{},
+		countingFetcher: countingFetcher{fetched: make(map[string]int)},
+	}
+	outputer := &countingOutputer{output: make(map[string]int)}
+	robots := &mockRobots{map[string]bool{"http://www.baidu1.com/": true}}
+	scope := &mockScope{outOfScope: map[string]bool{"http://www.baidu3.com/": true}}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, robots, nil, scope)
+
+	// run
+	assert.NoError(t, crawler.RunOnce(context.Background()))
+
+	// final URLs disallowed or out of scope are neither output nor parsed
+	assert.Equal(t, map[string]int{url.QueryEscape("http://www.baidu5.com/"): 1}, outputer.output)
+	assert.Equal(t, []string{"http://www.baidu5.com/"}, bases)
+}
+
+// implement for Fetcher, returns results of urls by results
+type resultFetcher struct {
+	results map[string]*fetcher.FetchResult
+}
+
+func (m *resultFetcher) Fetch(ctx context.Context, url string) (*fetcher.FetchResult, error) {
+	return m.results[url], nil
+}
+
+func TestRunOnce_ContentType(t *testing.T) {
+	var lock sync.Mutex
+	parsed := []string{}
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		parsed = append(parsed, u.String())
+	})
+	defer guard.Unpatch()
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   8,
+	}
+	seeds := []string{"http://www.baidu.com", "http://www.baidu1.com", "http://www.baidu2.com"}
+	results := map[string]*fetcher.FetchResult{}
+	for url, contentType := range map[string]string{
+		"http://www.baidu.com":  "text/html",
+		"http://www.baidu1.com": "application/xhtml+xml",
+		"http://www.baidu2.com": "image/png",
+	} {
+		results[url] = newFetchResult(url, []byte("test"))
+		results[url].ContentType = contentType
+	}
+	outputer := &countingOutputer{output: make(map[string]int)}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, &resultFetcher{results}, outputer, nil, nil, nil)
+
+	// run
+	assert.NoError(t, crawler.RunOnce(context.Background()))
+
+	// all output, only html parsed
+	assert.Equal(t, 3, len(outputer.output))
+	sort.Strings(parsed)
+	assert.Equal(t, []string{"http://www.baidu.com", "http://www.baidu1.com"}, parsed)
+}
+
+func TestRunOnce_NotModified(t *testing.T) {
+	var lock sync.Mutex
+	parsed := []string{}
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		parsed = append(parsed, u.String())
+	})
+	defer guard.Unpatch()
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   8,
+	}
+	seeds := []string{"http://www.baidu.com", "http://www.baidu1.com"}
+	results := map[string]*fetcher.FetchResult{
+		"http://www.baidu.com":  newFetchResult("http://www.baidu.com", []byte("test")),
+		"http://www.baidu1.com": newFetchResult("http://www.baidu1.com", []byte("stored")),
+	}
+	results["http://www.baidu1.com"].NotModified = true
+	outputer := &savedOutputer{countingOutputer{output: make(map[string]int)}, map[string]bool{url.QueryEscape("http://www.baidu1.com"): true}}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, &resultFetcher{results}, outputer, nil, nil, nil)
+
+	// run
+	assert.NoError(t, crawler.RunOnce(context.Background()))
+
+	// not modified page saved already is parsed but not output
+	assert.Equal(t, map[string]int{url.QueryEscape("http://www.baidu.com"): 1}, outputer.output)
+	sort.Strings(parsed)
+	assert.Equal(t, []string{"http://www.baidu.com", "http://www.baidu1.com"}, parsed)
+}
+
+func TestRunOnce_NotModifiedNotSaved(t *testing.T) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {})
+	defer guard.Unpatch()
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   8,
+	}
+	seeds := []string{"http://www.baidu.com", "http://www.baidu1.com"}
+	results := map[string]*fetcher.FetchResult{
+		"http://www.baidu.com":  newFetchResult("http://www.baidu.com", []byte("stored")),
+		"http://www.baidu1.com": newFetchResult("http://www.baidu1.com", []byte("stored1")),
+	}
+	results["http://www.baidu.com"].NotModified = true
+	results["http://www.baidu1.com"].NotModified = true
+
+	// output directory wiped, stored copies are output
+	outputer := &savedOutputer{countingOutputer{output: make(map[string]int)}, map[string]bool{}}
+	crawler := NewCrawler(cfg, seeds, &resultFetcher{results}, outputer, nil, nil, nil)
+	assert.NoError(t, crawler.RunOnce(context.Background()))
+	assert.Equal(t, map[string]int{url.QueryEscape("http://www.baidu.com"): 1, url.QueryEscape("http://www.baidu1.com"): 1}, outputer.outputs())
+
+	// outputer can not tell, like append-only streams, trusted to have them saved
+	counting := &countingOutputer{output: make(map[string]int)}
+	crawler = NewCrawler(cfg, seeds, &resultFetcher{results}, counting, nil, nil, nil)
+	assert.NoError(t, crawler.RunOnce(context.Background()))
+	assert.Empty(t, counting.outputs())
+}
+
+// implement for Outputer and SavedChecker, pages in saved are saved already
+type savedOutputer struct {
+	countingOutputer
+	saved map[string]bool
+}
+
+func (m *savedOutputer) Saved(fileName string, res *fetcher.FetchResult) bool {
+	return m.saved[fileName]
+}
+
+func (m *countingOutputer) outputs() map[string]int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.output
+}
+
+func TestHostFailed(t *testing.T) {
+	assert.False(t, hostFailed(nil))
+	assert.False(t, hostFailed(errors.New("other")))
+	assert.False(t, hostFailed(&fetcher.StatusError{StatusCode: 404}))
+	assert.True(t, hostFailed(&fetcher.StatusError{StatusCode: 429}))
+	assert.True(t, hostFailed(fmt.Errorf("wrapped: %w", &fetcher.StatusError{StatusCode: 503})))
+	assert.True(t, hostFailed(&fetcher.TimeoutError{}))
+	assert.True(t, hostFailed(&fetcher.NetworkError{}))
+	assert.False(t, hostFailed(&fetcher.DNSError{}))
+}
@@ -0,0 +1,68 @@
+// daemon.go - run crawler as daemon, re-crawl seeds circularly.
+
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/baidu/go-lib/log"
+)
+
+// RunDaemon runs crawler in rounds until ctx is done.
+// Every round crawls seeds and URLs due for revisiting,
+// a new round starts c.recrawlInterval after the last one started.
+// When ctx is done, fetching tasks are cancelled and queued tasks are dropped,
+// no goroutine started by crawler is left behind after it returns.
+func (c *Crawler) RunDaemon(ctx context.Context) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+	defer c.release()
+
+	if c.revisit == nil {
+		return fmt.Errorf("crawler is not configured as daemon")
+	}
+
+	c.startWorkers(ctx)
+	defer c.stopWorkers()
+
+	for round := 0; ; round++ {
+		start := time.Now()
+
+		log.Logger.Info("RunDaemon(): round %d starts", round)
+
+		c.runRound(ctx, round == 0)
+
+		if ctx.Err() != nil {
+			log.Logger.Info("RunDaemon(): stopped in round %d", round)
+			return nil
+		}
+
+		log.Logger.Info("RunDaemon(): round %d finished, cost %v", round, time.Since(start))
+
+		// wait for next round
+		timer := time.NewTimer(time.Until(start.Add(c.recrawlInterval)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Logger.Info("RunDaemon(): stopped after round %d", round)
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// Crawl one round, returns when all tasks of the round are done.
+func (c *Crawler) runRound(ctx context.Context, first bool) {
+	// URLs are deduplicated within one round only, revisit table takes over across rounds
+	if err := c.fetchedURL.Reset(); err != nil {
+		log.Logger.Error("runRound(): fetchedURL.Reset(): %v", err)
+	}
+	visitedURLs.Set(float64(c.fetchedURL.Len()))
+
+	c.initTasks(first)
+
+	c.taskManager.Wait()
+}
@@ -0,0 +1,124 @@
+// daemon_test.go - UT for daemon.go.
+
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"bou.ke/monkey"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+	"github.com/NKztq/spider/parser"
+)
+
+// implement for Fetcher, counts fetches of each URL
+type countingFetcher struct {
+	changing string // URL whose content changes every fetch
+
+	lock    sync.Mutex
+	fetched map[string]int
+}
+
+// implement for Outputer, counts outputs of each file
+type countingOutputer struct {
+	lock   sync.Mutex
+	output map[string]int
+}
+
+func (m *countingFetcher) Fetch(ctx context.Context, url string) (*fetcher.FetchResult, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.fetched[url]++
+
+	if url == m.changing {
+		return newFetchResult(url, []byte(fmt.Sprintf("test%d", m.fetched[url]))), nil
+	}
+
+	return newFetchResult(url, []byte("test")), nil
+}
+
+func (m *countingOutputer) OutputFile(fileName string, res *fetcher.FetchResult) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.output[fileName]++
+
+	return nil
+}
+
+func runDaemonFor(t *testing.T, fetcher Fetcher, outputer Outputer, duration time.Duration) {
+	guard := monkey.Patch(parser.Parse, func(n *html.Node, u *url.URL, e parser.Extractors, d *[]*url.URL) {
+		u1, _ := url.Parse("http://www.baidu1.com")
+		u2, _ := url.Parse("http://www.baidu2.com")
+		*d = append(*d, u1)
+		*d = append(*d, u2)
+	})
+	defer guard.Unpatch()
+
+	// param
+	cfg := conf.CrawlerConf{
+		MaxDepth:           1,
+		CrawlInterval:      conf.Duration(time.Second),
+		ThreadCount:        8,
+		Daemon:             true,
+		RecrawlInterval:    1,
+		MinRevisitInterval: 3600,
+		MaxRevisitInterval: 3600,
+	}
+	seeds := []string{"http://www.baidu.com"}
+
+	// new
+	crawler := NewCrawler(cfg, seeds, fetcher, outputer, nil, nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	before := runtime.NumGoroutine()
+	assert.NoError(t, crawler.RunDaemon(ctx))
+	assertNoGoroutineLeak(t, before)
+}
+
+func TestRunDaemon_Unchanged(t *testing.T) {
+	fetcher := &countingFetcher{fetched: make(map[string]int)}
+	outputer := &countingOutputer{output: make(map[string]int)}
+
+	// round 0 starts at 0s, round 1 starts at 1s, stopped while waiting for round 2
+	runDaemonFor(t, fetcher, outputer, 1500*time.Millisecond)
+
+	// seed is fetched every round, but unchanged content is not output
+	assert.Equal(t, map[string]int{"http://www.baidu.com": 2, "http://www.baidu1.com": 1, "http://www.baidu2.com": 1}, fetcher.fetched)
+	assert.Equal(t, map[string]int{"http%3A%2F%2Fwww.baidu.com": 1, "http%3A%2F%2Fwww.baidu1.com": 1, "http%3A%2F%2Fwww.baidu2.com": 1}, outputer.output)
+}
+
+func TestRunDaemon_Changed(t *testing.T) {
+	fetcher := &countingFetcher{changing: "http://www.baidu.com", fetched: make(map[string]int)}
+	outputer := &countingOutputer{output: make(map[string]int)}
+
+	runDaemonFor(t, fetcher, outputer, 1500*time.Millisecond)
+
+	// changed seed is output again, further URLs are not due yet
+	assert.Equal(t, map[string]int{"http://www.baidu.com": 2, "http://www.baidu1.com": 1, "http://www.baidu2.com": 1}, fetcher.fetched)
+	assert.Equal(t, map[string]int{"http%3A%2F%2Fwww.baidu.com": 2, "http%3A%2F%2Fwww.baidu1.com": 1, "http%3A%2F%2Fwww.baidu2.com": 1}, outputer.output)
+}
+
+func TestRunDaemon_NotDaemon(t *testing.T) {
+	cfg := conf.CrawlerConf{
+		MaxDepth:      1,
+		CrawlInterval: conf.Duration(time.Second),
+		ThreadCount:   8,
+	}
+
+	crawler := NewCrawler(cfg, nil, &mockFetcher{}, &mockOutputer{}, nil, nil, nil)
+
+	assert.Error(t, crawler.RunDaemon(context.Background()))
+}
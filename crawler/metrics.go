@@ -0,0 +1,19 @@
+// metrics.go - metrics of crawler.
+
+package crawler
+
+import (
+	"github.com/NKztq/spider/metrics"
+)
+
+var (
+	taskQueueDepth = metrics.NewGauge("spider_task_queue_depth",
+		"Number of tasks waiting in frontier, in memory or spilled to disk.")
+
+	visitedURLs = metrics.NewGauge("spider_visited_urls",
+		"Number of URLs in visited set.")
+
+	hostWaitSeconds = metrics.NewHistogram("spider_host_wait_seconds",
+		"Time a task waits in the queue of its host before dispatched.",
+		metrics.ExponentialBuckets(0.01, 4, 8))
+)
@@ -0,0 +1,90 @@
+// order.go - order of tasks in frontier.
+
+package crawler
+
+import (
+	"net/url"
+
+	"github.com/NKztq/spider/conf"
+)
+
+// orders of frontier, applied to tasks in memory only.
+// Spilled tasks are loaded back in FIFO order, so that "bfs" is strict
+// only while queued tasks fit in frontierMemorySize.
+const (
+	OrderFIFO       = "fifo"       // first queued, first crawled
+	OrderBFS        = "bfs"        // breadth-first, shallower tasks first, then FIFO
+	OrderScore      = "score"      // higher score first, then FIFO
+	OrderRoundRobin = "roundrobin" // hosts take turns, FIFO within one host
+)
+
+// Check whether task a should be crawled before task b, by order.
+// Ties are broken by queuing sequence, so that order is deterministic.
+func taskBefore(order string, a, b *task) bool {
+	switch order {
+	case OrderBFS:
+		// depth of task is the depth left, larger for shallower tasks
+		if a.depth != b.depth {
+			return a.depth > b.depth
+		}
+	case OrderScore:
+		if a.score != b.score {
+			return a.score > b.score
+		}
+	}
+
+	return a.seq < b.seq
+}
+
+// taskHeap is a priority queue of tasks, implements heap.Interface.
+type taskHeap struct {
+	order string
+	tasks []*task
+}
+
+func (h *taskHeap) Len() int {
+	return len(h.tasks)
+}
+
+func (h *taskHeap) Less(i, j int) bool {
+	return taskBefore(h.order, h.tasks[i], h.tasks[j])
+}
+
+func (h *taskHeap) Swap(i, j int) {
+	h.tasks[i], h.tasks[j] = h.tasks[j], h.tasks[i]
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	h.tasks = append(h.tasks, x.(*task))
+}
+
+func (h *taskHeap) Pop() interface{} {
+	last := len(h.tasks) - 1
+	t := h.tasks[last]
+	h.tasks[last] = nil
+	h.tasks = h.tasks[:last]
+
+	return t
+}
+
+// Get the first task, h should not be empty.
+func (h *taskHeap) peek() *task {
+	return h.tasks[0]
+}
+
+// scoreRules scores URLs by pattern weights.
+type scoreRules []conf.ScoreRule
+
+// Score u by sum of weights of rules matched by it.
+func (r scoreRules) score(u *url.URL) float64 {
+	s := u.String()
+
+	score := 0.0
+	for _, rule := range r {
+		if rule.Pattern.MatchString(s) {
+			score += rule.Weight
+		}
+	}
+
+	return score
+}
@@ -0,0 +1,86 @@
+// order_test.go - UT for order.go.
+
+package crawler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/conf"
+)
+
+// Push tasks of urls and depths, and get URLs in order of dispatching.
+func dispatchOrder(t *testing.T, cfg conf.CrawlerConf, urls []string, depths []int) []string {
+	s := newScheduler(cfg)
+	finished := make(chan struct{})
+
+	for i, rawURL := range urls {
+		task := newTestTask(t, rawURL)
+		task.depth = depths[i]
+		s.push(task)
+	}
+
+	var order []string
+	for s.len() > 0 {
+		task := s.next(context.Background(), finished)
+		order = append(order, task.url.String())
+		s.done(task, fetchOutcome{fetched: true})
+	}
+
+	return order
+}
+
+func TestOrder(t *testing.T) {
+	urls := []string{"http://a.com/1", "http://a.com/2.html", "http://b.com/1", "http://b.com/2.html", "http://c.com/1.html"}
+	depths := []int{1, 2, 1, 2, 0}
+
+	cases := []struct {
+		cfg    conf.CrawlerConf
+		expect []string
+	}{
+		{
+			conf.CrawlerConf{},
+			[]string{"http://a.com/1", "http://a.com/2.html", "http://b.com/1", "http://b.com/2.html", "http://c.com/1.html"},
+		},
+		{
+			conf.CrawlerConf{FrontierOrder: OrderBFS},
+			[]string{"http://a.com/2.html", "http://b.com/2.html", "http://a.com/1", "http://b.com/1", "http://c.com/1.html"},
+		},
+		{
+			conf.CrawlerConf{FrontierOrder: OrderScore, ScoreRule: []string{"\\.html$ 10", "^http://b\\.com/ 1"}},
+			[]string{"http://b.com/2.html", "http://a.com/2.html", "http://c.com/1.html", "http://b.com/1", "http://a.com/1"},
+		},
+	}
+
+	for _, c := range cases {
+		c.cfg.MaxConnsPerHost = 10
+
+		// deterministic
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, c.expect, dispatchOrder(t, c.cfg, urls, depths), c.cfg.FrontierOrder)
+		}
+	}
+}
+
+func TestOrder_RoundRobin(t *testing.T) {
+	cfg := conf.CrawlerConf{FrontierOrder: OrderRoundRobin, MaxConnsPerHost: 10}
+	urls := []string{"http://a.com/1", "http://a.com/2", "http://a.com/3", "http://b.com/1", "http://b.com/2", "http://c.com/1"}
+	depths := []int{1, 1, 1, 1, 1, 1}
+	expect := []string{"http://a.com/1", "http://b.com/1", "http://c.com/1", "http://a.com/2", "http://b.com/2", "http://a.com/3"}
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, expect, dispatchOrder(t, cfg, urls, depths))
+	}
+}
+
+func TestScoreRules(t *testing.T) {
+	rules, err := conf.ParseScoreRules([]string{"\\.html$ 10", "baidu -2.5"})
+	assert.NoError(t, err)
+
+	u := newTestTask(t, "http://www.baidu.com/index.html").url
+	assert.Equal(t, 7.5, scoreRules(rules).score(u))
+	u = newTestTask(t, "http://www.sina.com.cn/").url
+	assert.Equal(t, 0.0, scoreRules(rules).score(u))
+}
@@ -0,0 +1,108 @@
+// revisit.go - per-URL revisit schedule for daemon mode.
+
+package crawler
+
+import (
+	"crypto/md5"
+	"sync"
+	"time"
+)
+
+// visit state of one URL
+type visitRecord struct {
+	depth    int            // max depth left when visited
+	digest   [md5.Size]byte // md5 of content of last visit
+	interval time.Duration  // current revisit interval
+	next     time.Time      // time when URL should be revisited
+}
+
+// revisitTable records when each visited URL is due for revisiting.
+// Interval of a URL is doubled when its content is unchanged,
+// and is reset to minInterval when its content changes.
+type revisitTable struct {
+	minInterval time.Duration
+	maxInterval time.Duration
+
+	lock    sync.Mutex
+	records map[string]*visitRecord // url => visit record
+}
+
+func newRevisitTable(minInterval, maxInterval time.Duration) *revisitTable {
+	return &revisitTable{
+		minInterval: minInterval,
+		maxInterval: maxInterval,
+		records:     make(map[string]*visitRecord),
+	}
+}
+
+// Check whether url should be fetched at now, unknown URLs are always due.
+func (r *revisitTable) due(url string, now time.Time) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	record, ok := r.records[url]
+	if !ok {
+		return true
+	}
+
+	return !now.Before(record.next)
+}
+
+// Make url due immediately.
+func (r *revisitTable) expire(url string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if record, ok := r.records[url]; ok {
+		record.next = time.Time{}
+	}
+}
+
+// Record a visit of url, returns whether its content changed since last visit.
+// Content of unknown URLs is treated as changed.
+func (r *revisitTable) update(url string, depth int, content []byte, now time.Time) bool {
+	digest := md5.Sum(content)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	record, ok := r.records[url]
+	if !ok {
+		record = &visitRecord{depth: depth}
+		r.records[url] = record
+	}
+
+	changed := !ok || record.digest != digest
+
+	if changed {
+		record.interval = r.minInterval
+	} else {
+		record.interval *= 2
+		if record.interval > r.maxInterval {
+			record.interval = r.maxInterval
+		}
+	}
+
+	if depth > record.depth {
+		record.depth = depth
+	}
+	record.digest = digest
+	record.next = now.Add(record.interval)
+
+	return changed
+}
+
+// Get tasks of URLs which are due at now.
+func (r *revisitTable) dueTasks(now time.Time) map[string]int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	tasks := make(map[string]int)
+	for url, record := range r.records {
+		if !now.Before(record.next) {
+			tasks[url] = record.depth
+		}
+	}
+
+	return tasks
+}
@@ -0,0 +1,46 @@
+// revisit_test.go - UT for revisit.go.
+
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevisitTable(t *testing.T) {
+	r := newRevisitTable(time.Minute, 3*time.Minute)
+	now := time.Now()
+	u := "http://www.baidu.com"
+
+	// unknown URL is due, and its content is changed
+	assert.True(t, r.due(u, now))
+	assert.True(t, r.update(u, 1, []byte("test"), now))
+	assert.False(t, r.due(u, now))
+	assert.True(t, r.due(u, now.Add(time.Minute)))
+
+	// unchanged, interval doubled
+	now = now.Add(time.Minute)
+	assert.False(t, r.update(u, 0, []byte("test"), now))
+	assert.False(t, r.due(u, now.Add(time.Minute)))
+	assert.True(t, r.due(u, now.Add(2*time.Minute)))
+
+	// unchanged, interval limited by maxInterval
+	now = now.Add(2 * time.Minute)
+	assert.False(t, r.update(u, 0, []byte("test"), now))
+	assert.True(t, r.due(u, now.Add(3*time.Minute)))
+
+	// changed, interval reset
+	now = now.Add(3 * time.Minute)
+	assert.True(t, r.update(u, 0, []byte("test1"), now))
+	assert.True(t, r.due(u, now.Add(time.Minute)))
+
+	// max depth is kept
+	assert.Equal(t, map[string]int{u: 1}, r.dueTasks(now.Add(time.Minute)))
+	assert.Empty(t, r.dueTasks(now))
+
+	// expire makes URL due at once
+	r.expire(u)
+	assert.True(t, r.due(u, now))
+}
@@ -0,0 +1,445 @@
+// scheduler.go - per-host politeness scheduler of tasks.
+
+package crawler
+
+import (
+	"container/heap"
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baidu/go-lib/log"
+
+	"github.com/NKztq/spider/canonicalizer"
+	"github.com/NKztq/spider/conf"
+)
+
+// queue of tasks of one host
+type hostQueue struct {
+	host  string
+	tasks *taskHeap // ordered by order of scheduler
+
+	lastDispatched uint64 // dispatch sequence of the last task dispatched, for round robin
+
+	interval    time.Duration // min interval between starts of two tasks
+	maxConns    int           // max tasks crawled concurrently
+	active      int           // tasks being crawled
+	nextAllowed time.Time     // next task can not start before it
+
+	minInterval time.Duration // lower bound of adaptive interval, raised by Crawl-delay
+	maxInterval time.Duration // upper bound of adaptive interval
+}
+
+// outcome of crawling a task, feeds adaptive interval
+type fetchOutcome struct {
+	fetched bool          // false if dropped before fetching
+	failed  bool          // host failed to serve, like timeout or 5xx
+	latency time.Duration // time spent fetching
+}
+
+var (
+	defaultFrontierMemorySize = 100000 // max tasks queued in memory if not configured
+)
+
+// Scheduler dispatches tasks to workers, a task is dispatched only when its host is ready:
+// its next-allowed time is reached and it has less than maxConns tasks being crawled.
+// Adding tasks never blocks, so that workers never wait for each other.
+// At most memorySize tasks are queued in memory, the rest are spilled to disk,
+// and are loaded back when memory queues are half drained.
+type scheduler struct {
+	lock    sync.Mutex
+	hosts   map[string]*hostQueue // canonical host => queue, kept after drained for next-allowed time
+	pending map[string]*hostQueue // hosts with queued tasks
+	size    int                   // count of tasks queued in memory
+	changed chan struct{}         // closed and replaced whenever hosts may become ready
+
+	memorySize int         // max tasks queued in memory
+	spill      *spillQueue // tasks spilled over from memory
+	lost       func(n int) // called with count of spilled tasks lost, like spill file broken, never dispatched
+
+	interval      time.Duration            // default interval of hosts
+	maxConns      int                      // default maxConns of hosts
+	hostIntervals map[string]time.Duration // per-host interval overrides
+	hostMaxConns  map[string]int           // per-host maxConns overrides
+
+	adaptive    bool          // adapt interval of hosts to their latency and errors
+	minInterval time.Duration // lower bound of adaptive interval
+	maxInterval time.Duration // upper bound of adaptive interval
+
+	order      string     // order of tasks in memory
+	scoreRules scoreRules // scores tasks for "score" order
+	queued     uint64     // sequence of tasks queued in memory
+	dispatched uint64     // sequence of tasks dispatched
+}
+
+func newScheduler(cfg conf.CrawlerConf) *scheduler {
+	maxConns := cfg.MaxConnsPerHost
+	if maxConns <= 0 {
+		maxConns = 1
+	}
+
+	// overrides are validated by cfg.Check()
+	hostIntervals, err := conf.ParseHostDurations(cfg.HostInterval)
+	if err != nil {
+		log.Logger.Warn("newScheduler(): conf.ParseHostDurations(): %v", err)
+	}
+	hostMaxConns, err := conf.ParseHostValues(cfg.HostMaxConns)
+	if err != nil {
+		log.Logger.Warn("newScheduler(): conf.ParseHostValues(): %v", err)
+	}
+
+	order := cfg.FrontierOrder
+	if order == "" {
+		order = OrderFIFO
+	}
+	rules, err := conf.ParseScoreRules(cfg.ScoreRule)
+	if err != nil {
+		log.Logger.Warn("newScheduler(): conf.ParseScoreRules(): %v", err)
+	}
+
+	memorySize := cfg.FrontierMemorySize
+	if memorySize <= 0 {
+		memorySize = defaultFrontierMemorySize
+	}
+
+	return &scheduler{
+		hosts:         make(map[string]*hostQueue),
+		pending:       make(map[string]*hostQueue),
+		changed:       make(chan struct{}),
+		memorySize:    memorySize,
+		spill:         newSpillQueue(cfg.FrontierDirectory),
+		interval:      time.Duration(cfg.CrawlInterval),
+		maxConns:      maxConns,
+		hostIntervals: hostIntervals,
+		hostMaxConns:  hostMaxConns,
+		adaptive:      cfg.AdaptiveInterval,
+		minInterval:   time.Duration(cfg.MinCrawlInterval),
+		maxInterval:   time.Duration(cfg.MaxCrawlInterval),
+		order:         order,
+		scoreRules:    rules,
+	}
+}
+
+// Get queue of host, created if absent. Should be called with s.lock held.
+func (s *scheduler) hostQueue(host string) *hostQueue {
+	h, ok := s.hosts[host]
+	if ok {
+		return h
+	}
+
+	h = &hostQueue{
+		host:        host,
+		tasks:       &taskHeap{order: s.order},
+		interval:    s.interval,
+		maxConns:    s.maxConns,
+		minInterval: s.minInterval,
+		maxInterval: s.maxInterval,
+	}
+	if interval, ok := s.hostIntervals[hostname(host)]; ok {
+		h.interval = interval
+	}
+	if s.adaptive {
+		h.interval = clampDuration(h.interval, h.minInterval, h.maxInterval)
+	}
+	if maxConns, ok := s.hostMaxConns[hostname(host)]; ok {
+		h.maxConns = maxConns
+	}
+	s.hosts[host] = h
+
+	return h
+}
+
+// Wake up workers waiting in s.next(). Should be called with s.lock held.
+func (s *scheduler) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Add t to queue of its host, or spill it to disk if memory queues are full.
+func (s *scheduler) push(t *task) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t.queuedAt = time.Now()
+
+	// once spilling, keep spilling until loaded back, so that tasks stay in order
+	if s.size >= s.memorySize || s.spill.len() > 0 {
+		err := s.spill.push(t)
+		if err == nil {
+			taskQueueDepth.Set(float64(s.size + s.spill.len()))
+			s.notify()
+			return
+		}
+
+		log.Logger.Warn("push(): url: %s, spill.push(): %v, queued in memory", t.url, err)
+	}
+
+	s.enqueue(t)
+	taskQueueDepth.Set(float64(s.size + s.spill.len()))
+
+	s.notify()
+}
+
+// Add t to queue of its host in memory. Should be called with s.lock held.
+func (s *scheduler) enqueue(t *task) {
+	s.queued++
+	t.seq = s.queued
+	if s.order == OrderScore {
+		t.score = s.scoreRules.score(t.url)
+	}
+
+	h := s.hostQueue(canonicalizer.Host(t.url))
+	heap.Push(h.tasks, t)
+	s.pending[h.host] = h
+	s.size++
+}
+
+// Load spilled tasks back into memory when memory queues are half drained.
+// Should be called with s.lock held.
+func (s *scheduler) loadSpilled() {
+	if s.spill.len() == 0 || s.size > s.memorySize/2 {
+		return
+	}
+
+	tasks, lost, err := s.spill.pop(s.memorySize - s.size)
+	if err != nil {
+		log.Logger.Error("loadSpilled(): spill.pop(): %v", err)
+	}
+	if lost > 0 {
+		log.Logger.Error("loadSpilled(): %d spilled tasks lost", lost)
+		taskQueueDepth.Set(float64(s.size + len(tasks) + s.spill.len()))
+		if s.lost != nil {
+			s.lost(lost)
+		}
+	}
+
+	for _, t := range tasks {
+		s.enqueue(t)
+	}
+}
+
+// Get count of queued tasks, in memory or spilled.
+func (s *scheduler) len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.size + s.spill.len()
+}
+
+// Drop spilled tasks and remove spill file.
+func (s *scheduler) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.spill.close(); err != nil {
+		log.Logger.Warn("close(): spill.close(): %v", err)
+	}
+	taskQueueDepth.Set(float64(s.size))
+}
+
+// Get next task whose host is ready, blocks until there is one.
+// Returns nil if finished is closed.
+// Once ctx is done, queued tasks are returned regardless of their hosts, so that they can be dropped soon.
+// Every returned task should be passed to s.done() after crawled.
+func (s *scheduler) next(ctx context.Context, finished <-chan struct{}) *task {
+	for {
+		s.lock.Lock()
+
+		s.loadSpilled()
+
+		now := time.Now()
+		h, wait := s.readyHost(now, ctx.Err() != nil)
+		if h != nil {
+			t := s.dispatch(h, now)
+			s.lock.Unlock()
+			return t
+		}
+
+		changed := s.changed
+		s.lock.Unlock()
+
+		// wake up once when ctx is done, to drain queued tasks
+		done := ctx.Done()
+		if ctx.Err() != nil {
+			done = nil
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+
+		select {
+		case <-finished:
+		case <-done:
+		case <-changed:
+		case <-timeout:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-finished:
+			return nil
+		default:
+		}
+	}
+}
+
+// Find the host whose task should be crawled first among hosts ready at now, ignoring politeness if force.
+// If none, returns the time to wait for the earliest one, 0 if no host with queued tasks can start.
+// Should be called with s.lock held.
+func (s *scheduler) readyHost(now time.Time, force bool) (*hostQueue, time.Duration) {
+	var best *hostQueue     // first ready host by order
+	var earliest *hostQueue // host with the earliest next-allowed time
+	for _, h := range s.pending {
+		if !force {
+			if h.active >= h.maxConns {
+				continue
+			}
+
+			if h.nextAllowed.After(now) {
+				if earliest == nil || h.nextAllowed.Before(earliest.nextAllowed) {
+					earliest = h
+				}
+				continue
+			}
+		}
+
+		if best == nil || s.hostBefore(h, best) {
+			best = h
+		}
+	}
+
+	if best != nil {
+		return best, 0
+	}
+
+	if earliest == nil {
+		return nil, 0
+	}
+
+	return nil, earliest.nextAllowed.Sub(now)
+}
+
+// Check whether host a should be dispatched before host b, both have queued tasks.
+func (s *scheduler) hostBefore(a, b *hostQueue) bool {
+	if s.order == OrderRoundRobin && a.lastDispatched != b.lastDispatched {
+		return a.lastDispatched < b.lastDispatched
+	}
+
+	return taskBefore(s.order, a.tasks.peek(), b.tasks.peek())
+}
+
+// Pop the first task of h, and reserve interval of h for it. Should be called with s.lock held.
+func (s *scheduler) dispatch(h *hostQueue, now time.Time) *task {
+	t := heap.Pop(h.tasks).(*task)
+	if h.tasks.Len() == 0 {
+		h.tasks.tasks = nil
+		delete(s.pending, h.host)
+	}
+	s.dispatched++
+	h.lastDispatched = s.dispatched
+	s.size--
+	taskQueueDepth.Set(float64(s.size + s.spill.len()))
+
+	hostWaitSeconds.Observe(now.Sub(t.queuedAt).Seconds())
+
+	h.active++
+	t.prevAllowed = h.nextAllowed
+	h.nextAllowed = now.Add(h.interval)
+	t.reservedUntil = h.nextAllowed
+
+	return t
+}
+
+// Mark t crawled. If t is not fetched, like disallowed by robots.txt,
+// interval reserved for it is released, so that next task of its host starts without waiting.
+// In adaptive mode, interval of its host is adapted to the outcome.
+func (s *scheduler) done(t *task, outcome fetchOutcome) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	h := s.hostQueue(canonicalizer.Host(t.url))
+	h.active--
+
+	// no other task is dispatched after t
+	if !outcome.fetched && h.nextAllowed.Equal(t.reservedUntil) {
+		h.nextAllowed = t.prevAllowed
+	}
+
+	if s.adaptive && outcome.fetched {
+		h.adapt(outcome, time.Now())
+	}
+
+	s.notify()
+}
+
+// Adapt interval of h to outcome of a fetch:
+// doubled when h fails, otherwise moved halfway towards latency of h,
+// so that it widens when h slows down or fails, and narrows back when h recovers.
+func (h *hostQueue) adapt(outcome fetchOutcome, now time.Time) {
+	old := h.interval
+	if outcome.failed {
+		h.interval = 2 * h.interval
+	} else {
+		h.interval = (h.interval + outcome.latency) / 2
+	}
+	h.interval = clampDuration(h.interval, h.minInterval, h.maxInterval)
+
+	// back off at once when widened
+	if h.interval > old && h.nextAllowed.Before(now.Add(h.interval)) {
+		h.nextAllowed = now.Add(h.interval)
+	}
+
+	if h.interval != old {
+		log.Logger.Debug("adapt(): host: %s, interval: %v => %v", h.host, old, h.interval)
+	}
+}
+
+// Raise interval of u's host to at least interval, like Crawl-delay of robots.txt.
+// In adaptive mode, interval of host never narrows below it either.
+func (s *scheduler) raiseInterval(u *url.URL, interval time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	h := s.hostQueue(canonicalizer.Host(u))
+	if interval > h.minInterval {
+		h.minInterval = interval
+	}
+	if interval > h.maxInterval {
+		h.maxInterval = interval
+	}
+
+	if interval <= h.interval {
+		return
+	}
+
+	h.nextAllowed = h.nextAllowed.Add(interval - h.interval)
+	h.interval = interval
+}
+
+// Limit d into [min, max].
+func clampDuration(d, min, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+
+	return d
+}
+
+// Get lower-cased host name of host, without port.
+func hostname(host string) string {
+	u := url.URL{Host: host}
+
+	return strings.ToLower(u.Hostname())
+}
@@ -0,0 +1,333 @@
+// scheduler_test.go - UT for scheduler.go.
+
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/conf"
+)
+
+func newTestTask(t *testing.T, rawURL string) *task {
+	u, err := url.Parse(rawURL)
+	assert.NoError(t, err)
+
+	return &task{url: u, depth: 1}
+}
+
+func TestScheduler_Interval(t *testing.T) {
+	s := newScheduler(conf.CrawlerConf{CrawlInterval: conf.Duration(200 * time.Millisecond)})
+	finished := make(chan struct{})
+
+	s.push(newTestTask(t, "http://www.baidu.com/1"))
+	s.push(newTestTask(t, "http://www.baidu.com/2"))
+	assert.Equal(t, 2, s.len())
+
+	start := time.Now()
+	t1 := s.next(context.Background(), finished)
+	assert.Equal(t, "/1", t1.url.Path)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+	s.done(t1, fetchOutcome{fetched: true})
+
+	t2 := s.next(context.Background(), finished)
+	assert.Equal(t, "/2", t2.url.Path)
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+	s.done(t2, fetchOutcome{fetched: true})
+
+	assert.Equal(t, 0, s.len())
+}
+
+func TestScheduler_CanonicalHost(t *testing.T) {
+	s := newScheduler(conf.CrawlerConf{CrawlInterval: conf.Duration(200 * time.Millisecond)})
+	finished := make(chan struct{})
+
+	// one host, whatever case and default port
+	s.push(newTestTask(t, "http://WWW.Baidu.com/1"))
+	s.push(newTestTask(t, "http://www.baidu.com:80/2"))
+	s.push(newTestTask(t, "https://www.baidu.com/3"))
+	assert.Len(t, s.hosts, 1)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		task := s.next(context.Background(), finished)
+		s.done(task, fetchOutcome{fetched: true})
+	}
+	assert.True(t, time.Since(start) >= 400*time.Millisecond)
+	assert.Equal(t, 0, s.len())
+}
+
+func TestScheduler_OtherHostNotBlocked(t *testing.T) {
+	s := newScheduler(conf.CrawlerConf{CrawlInterval: conf.Duration(time.Hour)})
+	finished := make(chan struct{})
+
+	s.push(newTestTask(t, "http://www.baidu.com/1"))
+	s.push(newTestTask(t, "http://www.baidu.com/2"))
+	s.push(newTestTask(t, "http://www.sina.com.cn/1"))
+
+	start := time.Now()
+	t1 := s.next(context.Background(), finished)
+	t2 := s.next(context.Background(), finished)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+	assert.NotEqual(t, t1.url.Host, t2.url.Host)
+	assert.Equal(t, 1, s.len())
+}
+
+func TestScheduler_MaxConns(t *testing.T) {
+	s := newScheduler(conf.CrawlerConf{MaxConnsPerHost: 2})
+	finished := make(chan struct{})
+
+	for _, rawURL := range []string{"http://www.baidu.com/1", "http://www.baidu.com/2", "http://www.baidu.com/3"} {
+		s.push(newTestTask(t, rawURL))
+	}
+
+	t1 := s.next(context.Background(), finished)
+	s.next(context.Background(), finished)
+
+	// third task waits until one of the first two is done
+	got := make(chan *task)
+	go func() {
+		got <- s.next(context.Background(), finished)
+	}()
+
+	select {
+	case <-got:
+		t.Fatalf("more than maxConns tasks dispatched")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	s.done(t1, fetchOutcome{fetched: true})
+	select {
+	case t3 := <-got:
+		assert.Equal(t, "/3", t3.url.Path)
+	case <-time.After(time.Second):
+		t.Fatalf("task not dispatched after done")
+	}
+}
+
+func TestScheduler_HostOverrides(t *testing.T) {
+	s := newScheduler(conf.CrawlerConf{
+		CrawlInterval: conf.Duration(time.Hour),
+		HostInterval:  []string{"www.baidu.com 1ms"},
+		HostMaxConns:  []string{"www.baidu.com 2"},
+	})
+	finished := make(chan struct{})
+
+	s.push(newTestTask(t, "http://WWW.baidu.com:8080/1"))
+	s.push(newTestTask(t, "http://WWW.baidu.com:8080/2"))
+
+	start := time.Now()
+	s.next(context.Background(), finished)
+	s.next(context.Background(), finished)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+}
+
+func TestScheduler_DoneNotFetched(t *testing.T) {
+	s := newScheduler(conf.CrawlerConf{CrawlInterval: conf.Duration(time.Hour)})
+	finished := make(chan struct{})
+
+	s.push(newTestTask(t, "http://www.baidu.com/1"))
+	s.push(newTestTask(t, "http://www.baidu.com/2"))
+
+	start := time.Now()
+	t1 := s.next(context.Background(), finished)
+
+	// reserved interval is released
+	s.done(t1, fetchOutcome{})
+	t2 := s.next(context.Background(), finished)
+	assert.Equal(t, "/2", t2.url.Path)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+}
+
+func TestScheduler_RaiseInterval(t *testing.T) {
+	s := newScheduler(conf.CrawlerConf{})
+	finished := make(chan struct{})
+
+	s.push(newTestTask(t, "http://www.baidu.com/1"))
+	s.push(newTestTask(t, "http://www.baidu.com/2"))
+
+	start := time.Now()
+	t1 := s.next(context.Background(), finished)
+	s.raiseInterval(t1.url, 200*time.Millisecond)
+
+	// lower interval is ignored
+	s.raiseInterval(t1.url, 100*time.Millisecond)
+	s.done(t1, fetchOutcome{fetched: true})
+
+	s.next(context.Background(), finished)
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+}
+
+func TestScheduler_Cancel(t *testing.T) {
+	s := newScheduler(conf.CrawlerConf{CrawlInterval: conf.Duration(time.Hour)})
+	finished := make(chan struct{})
+
+	s.push(newTestTask(t, "http://www.baidu.com/1"))
+	s.push(newTestTask(t, "http://www.baidu.com/2"))
+	s.next(context.Background(), finished)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// queued task is drained regardless of interval once ctx is done
+	start := time.Now()
+	t2 := s.next(ctx, finished)
+	assert.Equal(t, "/2", t2.url.Path)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestScheduler_Finished(t *testing.T) {
+	s := newScheduler(conf.CrawlerConf{})
+	finished := make(chan struct{})
+
+	got := make(chan *task)
+	go func() {
+		got <- s.next(context.Background(), finished)
+	}()
+
+	close(finished)
+	select {
+	case dispatched := <-got:
+		assert.Nil(t, dispatched)
+	case <-time.After(time.Second):
+		t.Fatalf("next() not returned after finished")
+	}
+}
+
+func TestScheduler_Adaptive(t *testing.T) {
+	s := newScheduler(conf.CrawlerConf{
+		CrawlInterval:    conf.Duration(time.Second),
+		AdaptiveInterval: true,
+		MinCrawlInterval: conf.Duration(100 * time.Millisecond),
+		MaxCrawlInterval: conf.Duration(3 * time.Second),
+	})
+	finished := make(chan struct{})
+
+	fetch := func(outcome fetchOutcome) time.Duration {
+		s.push(newTestTask(t, "http://www.baidu.com/"))
+		s.lock.Lock()
+		s.hosts["www.baidu.com"].nextAllowed = time.Time{}
+		s.lock.Unlock()
+
+		task := s.next(context.Background(), finished)
+		s.done(task, outcome)
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		return s.hosts["www.baidu.com"].interval
+	}
+
+	// widened on failures, up to max
+	assert.Equal(t, 2*time.Second, fetch(fetchOutcome{fetched: true, failed: true}))
+	assert.Equal(t, 3*time.Second, fetch(fetchOutcome{fetched: true, failed: true}))
+
+	// narrowed towards latency on recovery, down to min
+	assert.Equal(t, 1500*time.Millisecond, fetch(fetchOutcome{fetched: true}))
+	for i := 0; i < 10; i++ {
+		fetch(fetchOutcome{fetched: true})
+	}
+	assert.Equal(t, 100*time.Millisecond, fetch(fetchOutcome{fetched: true}))
+
+	// widened by slow responses
+	assert.Equal(t, 550*time.Millisecond, fetch(fetchOutcome{fetched: true, latency: time.Second}))
+
+	// not adapted if not fetched
+	assert.Equal(t, 550*time.Millisecond, fetch(fetchOutcome{}))
+}
+
+func TestScheduler_AdaptiveCrawlDelay(t *testing.T) {
+	s := newScheduler(conf.CrawlerConf{
+		CrawlInterval:    conf.Duration(time.Second),
+		AdaptiveInterval: true,
+		MinCrawlInterval: conf.Duration(100 * time.Millisecond),
+		MaxCrawlInterval: conf.Duration(3 * time.Second),
+	})
+	finished := make(chan struct{})
+
+	s.push(newTestTask(t, "http://www.baidu.com/"))
+	task := s.next(context.Background(), finished)
+	s.raiseInterval(task.url, 5*time.Second)
+	s.done(task, fetchOutcome{fetched: true})
+
+	// never narrowed below Crawl-delay
+	assert.Equal(t, 5*time.Second, s.hosts["www.baidu.com"].interval)
+}
+
+func TestScheduler_Spill(t *testing.T) {
+	directory, err := ioutil.TempDir("", "spill")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	s := newScheduler(conf.CrawlerConf{FrontierMemorySize: 2, FrontierDirectory: directory})
+	defer s.close()
+	finished := make(chan struct{})
+
+	for i := 0; i < 6; i++ {
+		s.push(newTestTask(t, fmt.Sprintf("http://www.baidu%d.com/", i)))
+	}
+	assert.Equal(t, 6, s.len())
+	assert.Equal(t, 2, s.size)
+	assert.Equal(t, 4, s.spill.len())
+
+	// spilled tasks are loaded back, never more than memory size in memory
+	var hosts []string
+	for i := 0; i < 6; i++ {
+		task := s.next(context.Background(), finished)
+		hosts = append(hosts, task.url.Host)
+		assert.True(t, s.size <= 2)
+		s.done(task, fetchOutcome{fetched: true})
+	}
+	assert.ElementsMatch(t, []string{"www.baidu0.com", "www.baidu1.com", "www.baidu2.com",
+		"www.baidu3.com", "www.baidu4.com", "www.baidu5.com"}, hosts)
+	assert.Equal(t, 0, s.len())
+}
+
+func TestScheduler_SpillBFS(t *testing.T) {
+	directory, err := ioutil.TempDir("", "spill")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	s := newScheduler(conf.CrawlerConf{FrontierMemorySize: 4, FrontierDirectory: directory, FrontierOrder: OrderBFS})
+	defer s.close()
+	finished := make(chan struct{})
+
+	// depth of task is the depth left, the last one is the shallowest but spilled
+	for i := 0; i < 5; i++ {
+		task := newTestTask(t, fmt.Sprintf("http://www.baidu%d.com/", i))
+		task.depth = i / 4
+		s.push(task)
+	}
+	assert.Equal(t, 1, s.spill.len())
+
+	// breadth-first in memory only, spilled task is loaded back after memory is half drained
+	var hosts []string
+	for i := 0; i < 5; i++ {
+		task := s.next(context.Background(), finished)
+		hosts = append(hosts, task.url.Host)
+		s.done(task, fetchOutcome{fetched: true})
+	}
+	assert.Equal(t, []string{"www.baidu0.com", "www.baidu1.com", "www.baidu4.com",
+		"www.baidu2.com", "www.baidu3.com"}, hosts)
+}
+
+func TestScheduler_SpillFailed(t *testing.T) {
+	s := newScheduler(conf.CrawlerConf{FrontierMemorySize: 1, FrontierDirectory: "./not-exist"})
+	finished := make(chan struct{})
+
+	// kept in memory
+	s.push(newTestTask(t, "http://www.baidu.com/"))
+	s.push(newTestTask(t, "http://www.sina.com.cn/"))
+	assert.Equal(t, 2, s.size)
+
+	s.next(context.Background(), finished)
+	s.next(context.Background(), finished)
+	assert.Equal(t, 0, s.len())
+}
@@ -0,0 +1,161 @@
+// spill.go - disk queue of tasks spilled over from memory.
+
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"time"
+)
+
+// task saved in spill file, one JSON per line
+type spillRecord struct {
+	URL      string `json:"url"`
+	Depth    int    `json:"depth"`
+	QueuedAt int64  `json:"queued_at"` // unix nano
+}
+
+// spillQueue is a FIFO queue of tasks in a temporary file.
+// Tasks are appended to the end and read from readOffset,
+// the file is truncated whenever all tasks are read, so it never grows beyond the backlog.
+// It is not safe for concurrent use.
+type spillQueue struct {
+	directory string // directory of spill file, system temp directory if empty
+
+	file       *os.File // opened when the first task is spilled
+	writer     *bufio.Writer
+	readOffset int64 // offset of the first unread task
+	count      int   // count of unread tasks
+}
+
+func newSpillQueue(directory string) *spillQueue {
+	return &spillQueue{directory: directory}
+}
+
+// Get count of tasks in q.
+func (q *spillQueue) len() int {
+	return q.count
+}
+
+// Append t to q.
+func (q *spillQueue) push(t *task) error {
+	if q.file == nil {
+		file, err := ioutil.TempFile(q.directory, "frontier-*.spill")
+		if err != nil {
+			return fmt.Errorf("ioutil.TempFile(): %v", err)
+		}
+		q.file = file
+		q.writer = bufio.NewWriter(file)
+	}
+
+	line, err := json.Marshal(spillRecord{URL: t.url.String(), Depth: t.depth, QueuedAt: t.queuedAt.UnixNano()})
+	if err != nil {
+		return fmt.Errorf("json.Marshal(): %v", err)
+	}
+
+	// writes go to the end, since offset of file is moved by writes only
+	if _, err := q.writer.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write spill file: %v", err)
+	}
+	q.count++
+
+	return nil
+}
+
+// Remove and get at most n tasks from the head of q, with count of tasks lost.
+// Records which can not be decoded are dropped and counted as lost,
+// so are all unread tasks once spill file is broken.
+func (q *spillQueue) pop(n int) ([]*task, int, error) {
+	if q.count == 0 || n <= 0 {
+		return nil, 0, nil
+	}
+
+	if err := q.writer.Flush(); err != nil {
+		// tasks buffered by failed writes can not be read back
+		return nil, q.drop(), fmt.Errorf("flush spill file: %v", err)
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(q.file, q.readOffset, math.MaxInt64-q.readOffset))
+
+	var tasks []*task
+	lost := 0
+	for len(tasks) < n && q.count > 0 {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// spill file is broken, drop the rest rather than fail again and again
+			lost += q.drop()
+			return tasks, lost, fmt.Errorf("read spill file: %v", err)
+		}
+		q.readOffset += int64(len(line))
+		q.count--
+
+		var record spillRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			lost++
+			continue
+		}
+		u, err := url.Parse(record.URL)
+		if err != nil {
+			lost++
+			continue
+		}
+
+		tasks = append(tasks, &task{url: u, depth: record.Depth, queuedAt: time.Unix(0, record.QueuedAt)})
+	}
+
+	// all read, reuse file from the beginning
+	if q.count == 0 {
+		if err := q.reset(); err != nil {
+			return tasks, lost, err
+		}
+	}
+
+	return tasks, lost, nil
+}
+
+// Drop all unread tasks, returns count of them.
+func (q *spillQueue) drop() int {
+	lost := q.count
+	q.count = 0
+	q.reset()
+
+	return lost
+}
+
+// Truncate spill file, q should be empty.
+func (q *spillQueue) reset() error {
+	q.readOffset = 0
+	q.writer.Reset(q.file)
+
+	if err := q.file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate spill file: %v", err)
+	}
+	if _, err := q.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek spill file: %v", err)
+	}
+
+	return nil
+}
+
+// Drop all tasks, and remove spill file.
+func (q *spillQueue) close() error {
+	q.count = 0
+	q.readOffset = 0
+
+	if q.file == nil {
+		return nil
+	}
+
+	name := q.file.Name()
+	q.file.Close()
+	q.file = nil
+	q.writer = nil
+
+	return os.Remove(name)
+}
@@ -0,0 +1,115 @@
+// spill_test.go - UT for spill.go.
+
+package crawler
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpillQueue(t *testing.T) {
+	directory, err := ioutil.TempDir("", "spill")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	q := newSpillQueue(directory)
+	assert.Equal(t, 0, q.len())
+
+	tasks, lost, err := q.pop(10)
+	assert.NoError(t, err)
+	assert.Empty(t, tasks)
+	assert.Equal(t, 0, lost)
+
+	queuedAt := time.Unix(0, 1234567890)
+	for _, rawURL := range []string{"http://www.baidu.com/1", "http://www.baidu.com/2", "http://www.sina.com.cn/3"} {
+		task := newTestTask(t, rawURL)
+		task.queuedAt = queuedAt
+		assert.NoError(t, q.push(task))
+	}
+	assert.Equal(t, 3, q.len())
+
+	// in order
+	tasks, lost, err = q.pop(2)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, lost)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "http://www.baidu.com/1", tasks[0].url.String())
+	assert.Equal(t, "http://www.baidu.com/2", tasks[1].url.String())
+	assert.Equal(t, 1, tasks[0].depth)
+	assert.True(t, queuedAt.Equal(tasks[0].queuedAt))
+	assert.Equal(t, 1, q.len())
+
+	// push after pop
+	assert.NoError(t, q.push(newTestTask(t, "http://www.baidu.com/4")))
+	tasks, lost, err = q.pop(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, lost)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "http://www.sina.com.cn/3", tasks[0].url.String())
+	assert.Equal(t, "http://www.baidu.com/4", tasks[1].url.String())
+
+	// file is truncated once drained
+	info, err := q.file.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+
+	assert.NoError(t, q.push(newTestTask(t, "http://www.baidu.com/5")))
+	tasks, lost, err = q.pop(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, lost)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, "http://www.baidu.com/5", tasks[0].url.String())
+
+	// file is removed
+	assert.NoError(t, q.close())
+	files, err := ioutil.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestSpillQueue_InvalidDirectory(t *testing.T) {
+	q := newSpillQueue("./not-exist")
+	assert.Error(t, q.push(newTestTask(t, "http://www.baidu.com/")))
+	assert.Equal(t, 0, q.len())
+}
+
+func TestSpillQueue_Corrupted(t *testing.T) {
+	directory, err := ioutil.TempDir("", "spill")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	q := newSpillQueue(directory)
+	defer q.close()
+
+	for _, rawURL := range []string{"http://www.baidu.com/1", "http://www.baidu.com/2", "http://www.baidu.com/3", "http://www.baidu.com/4"} {
+		assert.NoError(t, q.push(newTestTask(t, rawURL)))
+	}
+	assert.NoError(t, q.writer.Flush())
+
+	// first record can not be decoded
+	_, err = q.file.WriteAt([]byte("#"), 0)
+	assert.NoError(t, err)
+
+	tasks, lost, err := q.pop(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, lost)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, "http://www.baidu.com/2", tasks[0].url.String())
+	assert.Equal(t, 2, q.len())
+
+	// last record is cut, the rest are dropped
+	info, err := q.file.Stat()
+	assert.NoError(t, err)
+	assert.NoError(t, q.file.Truncate(info.Size()-2))
+
+	tasks, lost, err = q.pop(10)
+	assert.Error(t, err)
+	assert.Equal(t, 1, lost)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, "http://www.baidu.com/3", tasks[0].url.String())
+	assert.Equal(t, 0, q.len())
+}
@@ -0,0 +1,68 @@
+// charset.go - detect charset of text bodies and transcode them to UTF-8.
+
+package fetcher
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/baidu/go-lib/log"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	prescanLength = 1024 // bytes of body where <meta charset> is looked for, as html5 prescan
+)
+
+// charset of <meta charset="..."> or <meta http-equiv="Content-Type" content="...; charset=...">
+var metaCharsetPattern = regexp.MustCompile(`(?i)(<meta[^>]+charset\s*=\s*["']?)([\w.:-]+)`)
+
+// Check whether charset of media type should be detected.
+func isText(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/xhtml+xml"
+}
+
+// Detect charset of res's body by BOM, charset of Content-Type and <meta charset> in turn,
+// UTF-8 or windows-1252 if none is found.
+// Body is transcoded to UTF-8 if transcode is set, and res.Charset is kept as the original charset.
+func decodeBody(res *FetchResult, transcode bool) {
+	if !isText(res.ContentType) {
+		return
+	}
+
+	e, name, _ := charset.DetermineEncoding(res.Body, res.Header.Get("Content-Type"))
+	res.Charset = name
+
+	if !transcode || name == "utf-8" {
+		return
+	}
+
+	decoded, err := e.NewDecoder().Bytes(res.Body)
+	if err != nil {
+		log.Logger.Warn("decodeBody(): url: %s, charset: %s, decode failed: %v", res.FinalURL, name, err)
+		return
+	}
+
+	res.Body = rewriteMetaCharset(decoded)
+	res.Transcoded = true
+}
+
+// Rewrite charset in <meta> of transcoded body to utf-8, so that saved page is read correctly.
+func rewriteMetaCharset(body []byte) []byte {
+	head := body
+	if len(head) > prescanLength {
+		head = head[:prescanLength]
+	}
+
+	loc := metaCharsetPattern.FindSubmatchIndex(head)
+	if loc == nil {
+		return body
+	}
+
+	rewritten := make([]byte, 0, len(body))
+	rewritten = append(rewritten, body[:loc[4]]...)
+	rewritten = append(rewritten, "utf-8"...)
+	rewritten = append(rewritten, body[loc[5]:]...)
+
+	return rewritten
+}
@@ -0,0 +1,97 @@
+// charset_test.go - UT for charset.go.
+
+package fetcher
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func gbk(t *testing.T, s string) []byte {
+	encoded, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(s))
+	assert.NoError(t, err)
+
+	return encoded
+}
+
+func newTextResult(contentType string, body []byte) *FetchResult {
+	res := &FetchResult{Header: http.Header{}, Body: body}
+	res.Header.Set("Content-Type", contentType)
+	res.ContentType = "text/html"
+
+	return res
+}
+
+func TestDecodeBody_Header(t *testing.T) {
+	res := newTextResult("text/html; charset=GB2312", gbk(t, "<html>百度</html>"))
+
+	decodeBody(res, true)
+
+	assert.Equal(t, "gbk", res.Charset)
+	assert.True(t, res.Transcoded)
+	assert.Equal(t, "<html>百度</html>", string(res.Body))
+}
+
+func TestDecodeBody_MetaCharset(t *testing.T) {
+	res := newTextResult("text/html", gbk(t, `<html><head><meta charset="gbk"></head><body>新浪</body></html>`))
+
+	decodeBody(res, true)
+
+	assert.Equal(t, "gbk", res.Charset)
+	assert.True(t, res.Transcoded)
+	assert.Equal(t, `<html><head><meta charset="utf-8"></head><body>新浪</body></html>`, string(res.Body))
+
+	// http-equiv
+	res = newTextResult("text/html", gbk(t, `<meta http-equiv="Content-Type" content="text/html; charset=gb2312"><p>新浪</p>`))
+
+	decodeBody(res, true)
+
+	assert.Equal(t, "gbk", res.Charset)
+	assert.Equal(t, `<meta http-equiv="Content-Type" content="text/html; charset=utf-8"><p>新浪</p>`, string(res.Body))
+}
+
+func TestDecodeBody_BOM(t *testing.T) {
+	// BOM takes precedence over header
+	body := append([]byte{0xef, 0xbb, 0xbf}, "<p>百度</p>"...)
+	res := newTextResult("text/html; charset=gbk", body)
+
+	decodeBody(res, true)
+
+	assert.Equal(t, "utf-8", res.Charset)
+	assert.False(t, res.Transcoded)
+	assert.Equal(t, body, res.Body)
+}
+
+func TestDecodeBody_NoTranscode(t *testing.T) {
+	body := gbk(t, "<html>百度</html>")
+	res := newTextResult("text/html; charset=gbk", body)
+
+	decodeBody(res, false)
+
+	assert.Equal(t, "gbk", res.Charset)
+	assert.False(t, res.Transcoded)
+	assert.Equal(t, body, res.Body)
+}
+
+func TestDecodeBody_NotText(t *testing.T) {
+	body := []byte("\x89PNG\r\n\x1a\n")
+	res := newTextResult("image/png", body)
+	res.ContentType = "image/png"
+
+	decodeBody(res, true)
+
+	assert.Equal(t, "", res.Charset)
+	assert.Equal(t, body, res.Body)
+}
+
+func TestDecodeBody_UTF8(t *testing.T) {
+	res := newTextResult("text/html", []byte("<html>百度</html>"))
+
+	decodeBody(res, true)
+
+	assert.Equal(t, "utf-8", res.Charset)
+	assert.False(t, res.Transcoded)
+}
@@ -0,0 +1,120 @@
+// errors.go - typed errors of fetching, so that callers can tell them apart.
+
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// StatusError is returned when response status is not 200.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	RetryAfter time.Duration // Retry-After of response, 0 if absent
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("url: %s, status code: %d", e.URL, e.StatusCode)
+}
+
+// TimeoutError is returned when connecting or reading times out.
+type TimeoutError struct {
+	URL string
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("url: %s, timeout: %v", e.URL, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// DNSError is returned when host of URL can not be resolved.
+type DNSError struct {
+	URL string
+	Err error
+}
+
+func (e *DNSError) Error() string {
+	return fmt.Sprintf("url: %s, dns: %v", e.URL, e.Err)
+}
+
+func (e *DNSError) Unwrap() error {
+	return e.Err
+}
+
+// NetworkError is returned when connection fails, like refused, reset or unexpected EOF.
+type NetworkError struct {
+	URL string
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("url: %s, network: %v", e.URL, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// BodyTooLargeError is returned when body is larger than max body size.
+type BodyTooLargeError struct {
+	URL         string
+	MaxBodySize int64
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("url: %s, body larger than %d bytes", e.URL, e.MaxBodySize)
+}
+
+// RedirectError is returned when a redirect is not followed by redirect policy.
+type RedirectError struct {
+	URL       string // URL requested
+	Location  string // URL redirected to
+	CrossHost bool   // not followed because Location is on another host, otherwise too many redirects
+}
+
+func (e *RedirectError) Error() string {
+	if e.CrossHost {
+		return fmt.Sprintf("url: %s, cross-host redirect to %s not followed", e.URL, e.Location)
+	}
+
+	return fmt.Sprintf("url: %s, too many redirects, last to %s", e.URL, e.Location)
+}
+
+// Wrap err of requesting url into typed error.
+// Errors which are none of above, like cancellation, are returned as they are.
+func classifyError(url string, err error) error {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var opErr *net.OpError
+
+	var redirectErr *RedirectError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return err
+	case errors.As(err, &redirectErr):
+		return redirectErr
+	case errors.As(err, &dnsErr):
+		return &DNSError{url, err}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return &TimeoutError{url, err}
+	case errors.As(err, &opErr),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, io.EOF):
+		return &NetworkError{url, err}
+	default:
+		return err
+	}
+}
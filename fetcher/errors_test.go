@@ -0,0 +1,53 @@
+// errors_test.go - UT for errors.go.
+
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// net.Error which times out
+type fakeTimeout struct{}
+
+func (fakeTimeout) Error() string   { return "i/o timeout" }
+func (fakeTimeout) Timeout() bool   { return true }
+func (fakeTimeout) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	u := "http://example.com/"
+	wrap := func(err error) error {
+		return &url.Error{Op: "Get", URL: u, Err: err}
+	}
+
+	var dnsErr *DNSError
+	assert.True(t, errors.As(classifyError(u, wrap(&net.DNSError{Err: "no such host", Name: "example.com"})), &dnsErr))
+	assert.Equal(t, u, dnsErr.URL)
+
+	var timeoutErr *TimeoutError
+	assert.True(t, errors.As(classifyError(u, wrap(fakeTimeout{})), &timeoutErr))
+	assert.True(t, errors.As(classifyError(u, wrap(context.DeadlineExceeded)), &timeoutErr))
+
+	var networkErr *NetworkError
+	assert.True(t, errors.As(classifyError(u, wrap(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED})), &networkErr))
+	assert.True(t, errors.Is(networkErr, syscall.ECONNREFUSED))
+	assert.True(t, errors.As(classifyError(u, io.ErrUnexpectedEOF), &networkErr))
+
+	// left as they are
+	assert.True(t, errors.Is(classifyError(u, wrap(context.Canceled)), context.Canceled))
+	other := fmt.Errorf("unknown")
+	assert.Equal(t, other, classifyError(u, other))
+}
+
+func TestStatusError(t *testing.T) {
+	err := &StatusError{URL: "http://example.com/", StatusCode: 503}
+	assert.Equal(t, "url: http://example.com/, status code: 503", err.Error())
+}
@@ -3,54 +3,400 @@
 package fetcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/baidu/go-lib/log"
+
+	"github.com/NKztq/spider/cache"
 	"github.com/NKztq/spider/conf"
 )
 
+var (
+	// status codes retried if none is configured
+	defaultRetryStatus = []int{
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+
+	// network error classes retried if none is configured
+	defaultRetryError = []string{conf.RetryErrorTimeout, conf.RetryErrorNetwork}
+)
+
+var (
+	defaultMaxRedirects = 10 // max redirects followed if not configured
+)
+
+type Cache interface {
+	// Get stored entry of URL, nil if absent.
+	Get(url string) (*cache.Entry, error)
+
+	// Store entry of URL.
+	Put(url string, e *cache.Entry) error
+}
+
 type Fetcher struct {
 	client http.Client // client reused for fetching
+
+	maxBodySize int64 // max size of body, unlimited if 0
+	transcode   bool  // transcode text bodies to UTF-8 or not
+
+	maxRedirects      int  // max redirects followed
+	crossHostRedirect bool // follow redirects to other hosts or not
+
+	maxAttempts     int             // max attempts of one fetch
+	retryBackoff    time.Duration   // backoff before the first retry
+	retryMaxBackoff time.Duration   // max backoff between retries
+	retryStatus     map[int]bool    // status codes which can be retried
+	retryError      map[string]bool // network error classes which can be retried
+	maxRetryAfter   time.Duration   // max Retry-After honoured, unlimited if 0
+
+	cache Cache // validators and bodies for conditional requests, nil if disabled
+
+	userAgent string // User-Agent sent, a fake one of browsers if empty
 }
 
-func NewFetcher(cfg conf.FetcherConf) *Fetcher {
+// NewFetcher creates fetcher, cache is optional.
+func NewFetcher(cfg conf.FetcherConf, cache Cache) *Fetcher {
 	client := http.Client{
 		Timeout: time.Duration(cfg.CrawlTimeout) * time.Second,
 	}
 
-	return &Fetcher{client}
+	f := &Fetcher{
+		client:            client,
+		maxBodySize:       cfg.MaxBodySize,
+		transcode:         cfg.TranscodeToUTF8,
+		maxRedirects:      cfg.MaxRedirects,
+		crossHostRedirect: cfg.CrossHostRedirect,
+		maxAttempts:       cfg.MaxAttempts,
+		retryBackoff:      time.Duration(cfg.RetryBackoff) * time.Millisecond,
+		retryMaxBackoff:   time.Duration(cfg.RetryMaxBackoff) * time.Millisecond,
+		retryStatus:       make(map[int]bool),
+		retryError:        make(map[string]bool),
+		maxRetryAfter:     time.Duration(cfg.MaxRetryAfter) * time.Second,
+		cache:             cache,
+	}
+
+	retryStatus := cfg.RetryStatus
+	if len(retryStatus) == 0 {
+		retryStatus = defaultRetryStatus
+	}
+	for _, status := range retryStatus {
+		f.retryStatus[status] = true
+	}
+
+	retryError := cfg.RetryError
+	if len(retryError) == 0 {
+		retryError = defaultRetryError
+	}
+	for _, class := range retryError {
+		f.retryError[class] = true
+	}
+
+	if f.maxRedirects == 0 {
+		f.maxRedirects = defaultMaxRedirects
+	}
+	f.client.CheckRedirect = f.checkRedirect
+
+	return f
 }
 
-// Fetch body from URL.
-func (f *Fetcher) Fetch(url string) ([]byte, error) {
+// SetUserAgent makes fetcher send userAgent instead of fake ones, like the one robots.txt is matched for.
+func (f *Fetcher) SetUserAgent(userAgent string) {
+	f.userAgent = userAgent
+}
+
+// Apply redirect policy to req, via are requests already made, oldest first.
+func (f *Fetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	origin := via[0].URL.String()
+
+	if !f.crossHostRedirect && !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+		return &RedirectError{origin, req.URL.String(), true}
+	}
+
+	if len(via) > f.maxRedirects {
+		return &RedirectError{origin, req.URL.String(), false}
+	}
+
+	return nil
+}
+
+// Fetch URL, give up when ctx is done.
+// Redirects are followed by redirect policy, final URL and redirect chain are in result.
+// Retryable failures are retried with exponential backoff, up to maxAttempts in total.
+// Media type of body is sniffed if Content-Type is absent or generic,
+// charset of text body is detected, and body is transcoded to UTF-8 if configured.
+// If URL is in cache, request is conditional, and stored body is returned on 304 with NotModified set.
+// Errors are *StatusError, *TimeoutError, *DNSError, *NetworkError, *RedirectError,
+// *BodyTooLargeError, or others like cancellation.
+func (f *Fetcher) Fetch(ctx context.Context, url string) (*FetchResult, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := f.fetchOnce(ctx, url)
+		if err == nil {
+			return res, nil
+		}
+
+		delay, ok := f.retryDelay(err, attempt)
+		if !ok || ctx.Err() != nil {
+			return nil, err
+		}
+
+		log.Logger.Warn("Fetch(): attempt %d failed, retry after %v: %v", attempt, delay, err)
+		fetchRetries.Inc()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+	}
+}
+
+// Fetch URL once.
+func (f *Fetcher) fetchOnce(ctx context.Context, url string) (*FetchResult, error) {
 	// do fetch
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("http.NewRequest(): %v", err)
+		return nil, fmt.Errorf("http.NewRequestWithContext(): %v", err)
+	}
+
+	userAgent := f.userAgent
+	if userAgent == "" {
+		userAgent = fakeUA()
+	}
+	req.Header.Add("User-Agent", userAgent)
+
+	entry := f.cachedEntry(url)
+	if entry != nil {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
 	}
 
-	req.Header.Add("User-Agent", fakeUA())
+	start := time.Now()
+	defer func() {
+		fetchSeconds.Observe(time.Since(start).Seconds())
+	}()
 
 	resp, err := f.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("url: %s, client.Get(): %v", url, err)
+		err = classifyError(url, err)
+		fetchFailures.Inc(errorReason(err))
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	res := newFetchResult(url, resp)
+	res.FetchedAt = start
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		notModified.Inc()
+
+		// replay stored copy, which is of a 200 response, so that it is output as such
+		res.NotModified = true
+		res.StatusCode = http.StatusOK
+		res.Body = entry.Body
+		res.ContentType = entry.ContentType
+		res.Charset = entry.Charset
+		res.Transcoded = entry.Transcoded
+		res.Duration = time.Since(start)
+
+		res.Header = res.Header.Clone()
+		if entry.ContentType != "" {
+			res.Header.Set("Content-Type", storedContentType(entry))
+		}
+
+		return res, nil
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("url: %s, status code: %v", url, resp.StatusCode)
+		err := &StatusError{url, resp.StatusCode, parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+		fetchFailures.Inc(errorReason(err))
+		return nil, err
 	}
 
-	// read from URL
-	body, err := ioutil.ReadAll(resp.Body)
+	if f.maxBodySize > 0 && resp.ContentLength > f.maxBodySize {
+		err := &BodyTooLargeError{url, f.maxBodySize}
+		fetchFailures.Inc(errorReason(err))
+		return nil, err
+	}
+
+	// read from URL, one more byte to find body larger than max body size
+	var reader io.Reader = resp.Body
+	if f.maxBodySize > 0 {
+		reader = io.LimitReader(resp.Body, f.maxBodySize+1)
+	}
+
+	body, err := ioutil.ReadAll(reader)
+	bytesDownloaded.Add(float64(len(body)))
 	if err != nil {
-		return nil, fmt.Errorf("ioutil.ReadAll(): %v", err)
+		err = classifyError(url, err)
+		fetchFailures.Inc(errorReason(err))
+		return nil, err
+	}
+
+	if f.maxBodySize > 0 && int64(len(body)) > f.maxBodySize {
+		err := &BodyTooLargeError{url, f.maxBodySize}
+		fetchFailures.Inc(errorReason(err))
+		return nil, err
+	}
+
+	pagesFetched.Inc()
+
+	res.Body = body
+	res.ContentType = sniffContentType(res.ContentType, body)
+	decodeBody(res, f.transcode)
+	res.Duration = time.Since(start)
+
+	f.store(res)
+
+	return res, nil
+}
+
+// Get Content-Type of stored copy in entry, with charset of stored body if known.
+func storedContentType(entry *cache.Entry) string {
+	if entry.Charset == "" || entry.Transcoded {
+		return entry.ContentType
+	}
+
+	return mime.FormatMediaType(entry.ContentType, map[string]string{"charset": entry.Charset})
+}
+
+// Get cached entry of url, nil if absent or cache is disabled.
+func (f *Fetcher) cachedEntry(url string) *cache.Entry {
+	if f.cache == nil {
+		return nil
+	}
+
+	entry, err := f.cache.Get(url)
+	if err != nil {
+		log.Logger.Warn("cachedEntry(): url: %s, cache.Get(): %v", url, err)
+		return nil
+	}
+
+	return entry
+}
+
+// Store validators and body of res, if it has any validator.
+func (f *Fetcher) store(res *FetchResult) {
+	lastModified := res.Header.Get("Last-Modified")
+	if f.cache == nil || (res.ETag == "" && lastModified == "") {
+		return
+	}
+
+	entry := &cache.Entry{
+		URL:          res.URL,
+		ETag:         res.ETag,
+		LastModified: lastModified,
+		ContentType:  res.ContentType,
+		Charset:      res.Charset,
+		Transcoded:   res.Transcoded,
+		Body:         res.Body,
+	}
+
+	if err := f.cache.Put(res.URL, entry); err != nil {
+		log.Logger.Warn("store(): url: %s, cache.Put(): %v", res.URL, err)
+	}
+}
+
+// Get delay before retrying after the attempt-th attempt failed by err.
+// Returns false if err should not be retried.
+func (f *Fetcher) retryDelay(err error, attempt int) (time.Duration, bool) {
+	if attempt >= f.maxAttempts {
+		return 0, false
+	}
+
+	var statusErr *StatusError
+	var timeoutErr *TimeoutError
+	var dnsErr *DNSError
+	var networkErr *NetworkError
+
+	switch {
+	case errors.As(err, &statusErr):
+		if !f.retryStatus[statusErr.StatusCode] {
+			return 0, false
+		}
+
+		// honour Retry-After of server, however long if maxRetryAfter is 0
+		if statusErr.RetryAfter > 0 {
+			if f.maxRetryAfter > 0 && statusErr.RetryAfter > f.maxRetryAfter {
+				return 0, false
+			}
+			return statusErr.RetryAfter, true
+		}
+	case errors.As(err, &timeoutErr):
+		if !f.retryError[conf.RetryErrorTimeout] {
+			return 0, false
+		}
+	case errors.As(err, &dnsErr):
+		if !f.retryError[conf.RetryErrorDNS] {
+			return 0, false
+		}
+	case errors.As(err, &networkErr):
+		if !f.retryError[conf.RetryErrorNetwork] {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	return backoff(f.retryBackoff, f.retryMaxBackoff, attempt), true
+}
+
+// Get backoff before the attempt-th retry, doubled for each retry and limited by max,
+// with jitter in [backoff/2, backoff], so that retries of many tasks are spread.
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	if d <= 1 {
+		return d
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// Parse value of Retry-After, in seconds or HTTP date. Returns 0 if absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
 	}
 
-	return body, nil
+	return 0
 }
 
 // Give a fake User-Agent.
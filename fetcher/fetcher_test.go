@@ -3,21 +3,31 @@
 package fetcher
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/NKztq/spider/cache"
+	"github.com/NKztq/spider/canonicalizer"
 	"github.com/NKztq/spider/conf"
 )
 
 func TestFetch(t *testing.T) {
-	conf := conf.FetcherConf{1}
+	conf := conf.FetcherConf{CrawlTimeout: 1}
 
-	fetcher := NewFetcher(conf)
+	fetcher := NewFetcher(conf, nil)
 
 	html, err := ioutil.ReadFile("./testdata/mock.html")
 	assert.NoError(t, err)
@@ -29,7 +39,480 @@ func TestFetch(t *testing.T) {
 	}))
 
 	// Fetch
-	res, err := fetcher.Fetch(ts.URL)
+	res, err := fetcher.Fetch(context.Background(), ts.URL)
 	assert.NoError(t, err)
-	assert.Equal(t, html, res)
+	assert.Equal(t, html, res.Body)
+}
+
+func TestFetch_UserAgent(t *testing.T) {
+	var userAgent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+	}))
+	defer ts.Close()
+
+	f := NewFetcher(conf.FetcherConf{CrawlTimeout: 1}, nil)
+	_, err := f.Fetch(context.Background(), ts.URL)
+	assert.NoError(t, err)
+	assert.Contains(t, userAgent, "Mozilla/5.0")
+
+	f.SetUserAgent("mini_spider")
+	_, err = f.Fetch(context.Background(), ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "mini_spider", userAgent)
+}
+
+func TestFetch_Metrics(t *testing.T) {
+	conf := conf.FetcherConf{CrawlTimeout: 1}
+
+	fetcher := NewFetcher(conf, nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, "hello")
+	}))
+	defer ts.Close()
+
+	pages := pagesFetched.Value()
+	bytes := bytesDownloaded.Value()
+	notFound := fetchFailures.Value("404")
+	fetches := fetchSeconds.Count()
+
+	_, err := fetcher.Fetch(context.Background(), ts.URL)
+	assert.NoError(t, err)
+
+	_, err = fetcher.Fetch(context.Background(), ts.URL+"/missing")
+	assert.Error(t, err)
+
+	assert.Equal(t, pages+1, pagesFetched.Value())
+	assert.Equal(t, bytes+5, bytesDownloaded.Value())
+	assert.Equal(t, notFound+1, fetchFailures.Value("404"))
+	assert.Equal(t, fetches+2, fetchSeconds.Count())
+}
+
+func TestErrorReason(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://127.0.0.1:1/", nil)
+	assert.NoError(t, err)
+	_, err = http.DefaultClient.Do(req)
+	assert.Equal(t, "canceled", errorReason(classifyError("", err)))
+
+	assert.Equal(t, "503", errorReason(&StatusError{StatusCode: 503}))
+	assert.Equal(t, "dns", errorReason(&DNSError{Err: &net.DNSError{Err: "no such host", Name: "x"}}))
+	assert.Equal(t, "timeout", errorReason(&TimeoutError{Err: context.DeadlineExceeded}))
+	assert.Equal(t, "network", errorReason(&NetworkError{Err: io.ErrUnexpectedEOF}))
+	assert.Equal(t, "other", errorReason(fmt.Errorf("unknown")))
+}
+
+// Server failing with status for the first failures requests.
+func newFlakyServer(failures int, status int, header http.Header) (*httptest.Server, *int32) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(atomic.AddInt32(&count, 1)) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+
+	return ts, &count
+}
+
+func retryConf() conf.FetcherConf {
+	return conf.FetcherConf{
+		CrawlTimeout:    1,
+		MaxAttempts:     3,
+		RetryBackoff:    10,
+		RetryMaxBackoff: 50,
+		MaxRetryAfter:   1,
+	}
+}
+
+func TestFetch_RetrySucceeds(t *testing.T) {
+	ts, count := newFlakyServer(2, http.StatusServiceUnavailable, nil)
+	defer ts.Close()
+
+	res, err := NewFetcher(retryConf(), nil).Fetch(context.Background(), ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ok"), res.Body)
+	assert.Equal(t, int32(3), atomic.LoadInt32(count))
+}
+
+func TestFetch_RetryExhausted(t *testing.T) {
+	ts, count := newFlakyServer(5, http.StatusBadGateway, nil)
+	defer ts.Close()
+
+	_, err := NewFetcher(retryConf(), nil).Fetch(context.Background(), ts.URL)
+
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusBadGateway, statusErr.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(count))
+}
+
+func TestFetch_NotRetryable(t *testing.T) {
+	ts, count := newFlakyServer(1, http.StatusNotFound, nil)
+	defer ts.Close()
+
+	_, err := NewFetcher(retryConf(), nil).Fetch(context.Background(), ts.URL)
+
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(count))
+}
+
+func TestFetch_NoRetryByDefault(t *testing.T) {
+	ts, count := newFlakyServer(1, http.StatusServiceUnavailable, nil)
+	defer ts.Close()
+
+	_, err := NewFetcher(conf.FetcherConf{CrawlTimeout: 1}, nil).Fetch(context.Background(), ts.URL)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(count))
+}
+
+func TestFetch_RetryAfter(t *testing.T) {
+	ts, count := newFlakyServer(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}})
+	defer ts.Close()
+
+	start := time.Now()
+	res, err := NewFetcher(retryConf(), nil).Fetch(context.Background(), ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ok"), res.Body)
+	assert.Equal(t, int32(2), atomic.LoadInt32(count))
+	assert.True(t, time.Since(start) >= time.Second)
+}
+
+func TestFetch_RetryAfterTooLong(t *testing.T) {
+	ts, count := newFlakyServer(1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"120"}})
+	defer ts.Close()
+
+	_, err := NewFetcher(retryConf(), nil).Fetch(context.Background(), ts.URL)
+
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, 120*time.Second, statusErr.RetryAfter)
+	assert.Equal(t, int32(1), atomic.LoadInt32(count))
+}
+
+func TestFetch_RetryAfterUnlimited(t *testing.T) {
+	ts, count := newFlakyServer(1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"1"}})
+	defer ts.Close()
+
+	cfg := retryConf()
+	cfg.MaxRetryAfter = 0
+
+	start := time.Now()
+	res, err := NewFetcher(cfg, nil).Fetch(context.Background(), ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ok"), res.Body)
+	assert.Equal(t, int32(2), atomic.LoadInt32(count))
+	assert.True(t, time.Since(start) >= time.Second)
+}
+
+func TestFetch_RetryTimeout(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			time.Sleep(1500 * time.Millisecond)
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer ts.Close()
+
+	res, err := NewFetcher(retryConf(), nil).Fetch(context.Background(), ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ok"), res.Body)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+}
+
+func TestFetch_DNSNotRetriedByDefault(t *testing.T) {
+	cfg := retryConf()
+	f := NewFetcher(cfg, nil)
+
+	_, ok := f.retryDelay(&DNSError{Err: &net.DNSError{Err: "no such host"}}, 1)
+	assert.False(t, ok)
+
+	cfg.RetryError = []string{"dns"}
+	f = NewFetcher(cfg, nil)
+
+	_, ok = f.retryDelay(&DNSError{Err: &net.DNSError{Err: "no such host"}}, 1)
+	assert.True(t, ok)
+	_, ok = f.retryDelay(&TimeoutError{Err: context.DeadlineExceeded}, 1)
+	assert.False(t, ok)
+}
+
+func TestFetch_CancelDuringBackoff(t *testing.T) {
+	ts, count := newFlakyServer(5, http.StatusServiceUnavailable, http.Header{"Retry-After": {"1"}})
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := NewFetcher(retryConf(), nil).Fetch(ctx, ts.URL)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(count))
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestBackoff(t *testing.T) {
+	base := 100 * time.Millisecond
+	max := time.Second
+
+	for i := 0; i < 100; i++ {
+		d := backoff(base, max, 1)
+		assert.True(t, d >= 50*time.Millisecond && d <= 100*time.Millisecond, d)
+
+		d = backoff(base, max, 3)
+		assert.True(t, d >= 200*time.Millisecond && d <= 400*time.Millisecond, d)
+
+		d = backoff(base, max, 10)
+		assert.True(t, d >= 500*time.Millisecond && d <= time.Second, d)
+	}
+
+	assert.Equal(t, time.Duration(0), backoff(0, 0, 2))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 3, 2, 16, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, 2*time.Minute, parseRetryAfter("Mon, 02 Mar 2020 16:02:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Mon, 02 Mar 2020 15:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
+
+// Server redirecting /r/<n> to /r/<n-1>, and /r/0 to /final.
+func newRedirectServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/final" {
+			io.WriteString(w, "final")
+			return
+		}
+
+		var n int
+		fmt.Sscanf(r.URL.Path, "/r/%d", &n)
+		if n == 0 {
+			http.Redirect(w, r, "/final", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/r/%d", n-1), http.StatusMovedPermanently)
+	}))
+}
+
+func TestFetch_Redirect(t *testing.T) {
+	ts := newRedirectServer()
+	defer ts.Close()
+
+	res, err := NewFetcher(conf.FetcherConf{CrawlTimeout: 1}, nil).Fetch(context.Background(), ts.URL+"/r/1")
+	assert.NoError(t, err)
+	assert.Equal(t, ts.URL+"/r/1", res.URL)
+	assert.Equal(t, ts.URL+"/final", res.FinalURL)
+	assert.Equal(t, []Redirect{{ts.URL + "/r/1", 301}, {ts.URL + "/r/0", 302}}, res.Redirects)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, []byte("final"), res.Body)
+}
+
+func TestFetch_TooManyRedirects(t *testing.T) {
+	ts := newRedirectServer()
+	defer ts.Close()
+
+	f := NewFetcher(conf.FetcherConf{CrawlTimeout: 1, MaxRedirects: 2}, nil)
+
+	_, err := f.Fetch(context.Background(), ts.URL+"/r/1")
+	assert.NoError(t, err)
+
+	_, err = f.Fetch(context.Background(), ts.URL+"/r/2")
+	var redirectErr *RedirectError
+	assert.True(t, errors.As(err, &redirectErr))
+	assert.False(t, redirectErr.CrossHost)
+	assert.Equal(t, ts.URL+"/final", redirectErr.Location)
+
+	// no redirect followed
+	f = NewFetcher(conf.FetcherConf{CrawlTimeout: 1, MaxRedirects: -1}, nil)
+
+	_, err = f.Fetch(context.Background(), ts.URL+"/r/0")
+	assert.True(t, errors.As(err, &redirectErr))
+	assert.Equal(t, ts.URL+"/final", redirectErr.Location)
+}
+
+func TestFetch_CrossHostRedirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "target")
+	}))
+	defer target.Close()
+
+	// same port on another host name
+	targetURL := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, targetURL+"/", http.StatusMovedPermanently)
+	}))
+	defer ts.Close()
+
+	_, err := NewFetcher(conf.FetcherConf{CrawlTimeout: 1}, nil).Fetch(context.Background(), ts.URL)
+	var redirectErr *RedirectError
+	assert.True(t, errors.As(err, &redirectErr))
+	assert.True(t, redirectErr.CrossHost)
+	assert.Equal(t, ts.URL, redirectErr.URL)
+	assert.Equal(t, targetURL+"/", redirectErr.Location)
+
+	res, err := NewFetcher(conf.FetcherConf{CrawlTimeout: 1, CrossHostRedirect: true}, nil).Fetch(context.Background(), ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, targetURL+"/", res.FinalURL)
+	assert.Equal(t, []byte("target"), res.Body)
+}
+
+func TestFetch_Result(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "Text/HTML; charset=GBK")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Mar 2020 08:00:00 GMT")
+		io.WriteString(w, "hello")
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	res, err := NewFetcher(conf.FetcherConf{CrawlTimeout: 1}, nil).Fetch(context.Background(), ts.URL)
+	assert.NoError(t, err)
+
+	assert.Equal(t, ts.URL, res.URL)
+	assert.Equal(t, ts.URL, res.FinalURL)
+	assert.Empty(t, res.Redirects)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "HTTP/1.1", res.Proto)
+	assert.NotEmpty(t, res.RequestHeader.Get("User-Agent"))
+	assert.Equal(t, "text/html", res.ContentType)
+	assert.Equal(t, "gbk", res.Charset)
+	assert.Equal(t, `"v1"`, res.ETag)
+	assert.True(t, res.LastModified.Equal(time.Date(2020, 3, 2, 8, 0, 0, 0, time.UTC)))
+	assert.False(t, res.FetchedAt.Before(start))
+	assert.True(t, res.Duration > 0)
+	assert.Equal(t, []byte("hello"), res.Body)
+}
+
+func TestFetch_SniffContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nrest of image")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/octet":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(png)
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, "<html></html>")
+		default:
+			// Content-Type is sniffed by net/http if not set, so set it empty
+			w.Header()["Content-Type"] = nil
+			io.WriteString(w, "<!DOCTYPE html><html></html>")
+		}
+	}))
+	defer ts.Close()
+
+	f := NewFetcher(conf.FetcherConf{CrawlTimeout: 1}, nil)
+
+	res, err := f.Fetch(context.Background(), ts.URL+"/octet")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", res.ContentType)
+
+	// header is trusted if not generic
+	res, err = f.Fetch(context.Background(), ts.URL+"/json")
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", res.ContentType)
+
+	res, err = f.Fetch(context.Background(), ts.URL+"/none")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/html", res.ContentType)
+}
+
+func TestFetch_MaxBodySize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// no Content-Length
+			w.(http.Flusher).Flush()
+		}
+		io.WriteString(w, strings.Repeat("a", 100))
+	}))
+	defer ts.Close()
+
+	f := NewFetcher(conf.FetcherConf{CrawlTimeout: 1, MaxBodySize: 100}, nil)
+	res, err := f.Fetch(context.Background(), ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, len(res.Body))
+
+	f = NewFetcher(conf.FetcherConf{CrawlTimeout: 1, MaxBodySize: 99}, nil)
+	for _, p := range []string{"/", "/chunked"} {
+		_, err = f.Fetch(context.Background(), ts.URL+p)
+		var tooLargeErr *BodyTooLargeError
+		assert.True(t, errors.As(err, &tooLargeErr), p)
+	}
+}
+
+func TestFetch_Conditional(t *testing.T) {
+	directory, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	c, err := cache.Open(directory, canonicalizer.NewCanonicalizer(false, nil))
+	assert.NoError(t, err)
+
+	var full, conditional int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/none" {
+			// no validator
+			io.WriteString(w, "none")
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Mar 2020 08:00:00 GMT")
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == "Mon, 02 Mar 2020 08:00:00 GMT" {
+			atomic.AddInt32(&conditional, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		atomic.AddInt32(&full, 1)
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<html>test</html>")
+	}))
+	defer ts.Close()
+
+	f := NewFetcher(conf.FetcherConf{CrawlTimeout: 1}, c)
+
+	res, err := f.Fetch(context.Background(), ts.URL+"/page")
+	assert.NoError(t, err)
+	assert.False(t, res.NotModified)
+	assert.Equal(t, []byte("<html>test</html>"), res.Body)
+
+	// stored copy is returned on 304
+	res, err = f.Fetch(context.Background(), ts.URL+"/page")
+	assert.NoError(t, err)
+	assert.True(t, res.NotModified)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/html", res.ContentType)
+	assert.True(t, strings.HasPrefix(res.Header.Get("Content-Type"), "text/html"))
+	assert.Equal(t, []byte("<html>test</html>"), res.Body)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&full))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conditional))
+
+	// not stored without validators
+	_, err = f.Fetch(context.Background(), ts.URL+"/none")
+	assert.NoError(t, err)
+	e, err := c.Get(ts.URL + "/none")
+	assert.NoError(t, err)
+	assert.Nil(t, e)
 }
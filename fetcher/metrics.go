@@ -0,0 +1,61 @@
+// metrics.go - metrics of fetcher.
+
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/NKztq/spider/metrics"
+)
+
+var (
+	pagesFetched = metrics.NewCounter("spider_pages_fetched_total",
+		"Number of pages fetched successfully.")
+
+	notModified = metrics.NewCounter("spider_fetch_not_modified_total",
+		"Number of conditional fetches answered with 304.")
+
+	fetchFailures = metrics.NewCounter("spider_fetch_failures_total",
+		"Number of failed fetches, by status code or error class.", "reason")
+
+	bytesDownloaded = metrics.NewCounter("spider_bytes_downloaded_total",
+		"Bytes of bodies downloaded.")
+
+	fetchRetries = metrics.NewCounter("spider_fetch_retries_total",
+		"Number of retries of failed fetches.")
+
+	fetchSeconds = metrics.NewHistogram("spider_fetch_duration_seconds",
+		"Latency of fetches, including failed ones.",
+		metrics.ExponentialBuckets(0.05, 2, 10))
+)
+
+// Get reason label of a failed fetch by its error.
+func errorReason(err error) string {
+	var statusErr *StatusError
+	var timeoutErr *TimeoutError
+	var dnsErr *DNSError
+	var networkErr *NetworkError
+	var redirectErr *RedirectError
+	var tooLargeErr *BodyTooLargeError
+
+	switch {
+	case errors.As(err, &statusErr):
+		return strconv.Itoa(statusErr.StatusCode)
+	case errors.As(err, &timeoutErr):
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.As(err, &networkErr):
+		return "network"
+	case errors.As(err, &redirectErr):
+		return "redirect"
+	case errors.As(err, &tooLargeErr):
+		return "too_large"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,92 @@
+// result.go - result of fetching.
+
+package fetcher
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FetchResult is response of a fetched URL.
+type FetchResult struct {
+	URL        string      // URL requested
+	FinalURL   string      // URL after redirects, equals URL if not redirected
+	Redirects  []Redirect  // redirects followed, in order
+	StatusCode int         // status code of final response, 200 of stored copy if NotModified
+	Proto      string      // protocol of final response, like "HTTP/1.1"
+	Header     http.Header // header of final response, with Content-Type of stored copy if NotModified
+	Body       []byte      // body of final response, or stored body if NotModified
+
+	RequestHeader http.Header // header of final request, without Host
+
+	NotModified bool // response is 304 to conditional request, body is the stored copy
+
+	ContentType  string    // media type of Content-Type, lower-cased, without params
+	Charset      string    // charset of original body, detected for text, otherwise charset param of Content-Type
+	Transcoded   bool      // body is transcoded to UTF-8 from Charset
+	LastModified time.Time // Last-Modified, zero if absent or invalid
+	ETag         string    // ETag, with quotes
+
+	FetchedAt time.Time     // time when request was sent
+	Duration  time.Duration // time cost of fetching, including redirects but not retries
+}
+
+// Redirect is one redirect followed.
+type Redirect struct {
+	URL        string `json:"url"`         // URL redirected from
+	StatusCode int    `json:"status_code"` // status code of redirect, like 301
+}
+
+// generic media types which are sniffed from body instead
+var genericContentTypes = map[string]bool{
+	"":                         true,
+	"application/octet-stream": true,
+	"application/unknown":      true,
+	"unknown/unknown":          true,
+}
+
+// Get media type of body, by Content-Type header or by sniffing if the header is absent or generic.
+func sniffContentType(headerType string, body []byte) string {
+	if !genericContentTypes[headerType] {
+		return headerType
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(body))
+	if err != nil {
+		return headerType
+	}
+
+	return mediaType
+}
+
+// Create result of resp, body is not read.
+func newFetchResult(url string, resp *http.Response) *FetchResult {
+	res := &FetchResult{
+		URL:        url,
+		FinalURL:   resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		Header:     resp.Header,
+		ETag:       resp.Header.Get("ETag"),
+
+		RequestHeader: resp.Request.Header,
+	}
+
+	if mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		res.ContentType = mediaType
+		res.Charset = strings.ToLower(params["charset"])
+	}
+
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		res.LastModified = t
+	}
+
+	// walk back through responses which caused requests
+	for req := resp.Request; req.Response != nil; req = req.Response.Request {
+		res.Redirects = append([]Redirect{{req.Response.Request.URL.String(), req.Response.StatusCode}}, res.Redirects...)
+	}
+
+	return res
+}
@@ -5,8 +5,11 @@ go 1.13
 require (
 	bou.ke/monkey v0.0.0-00010101000000-000000000000
 	github.com/baidu/go-lib v0.0.0-20191217050907-c1bbbad6b030
+	github.com/klauspost/compress v1.11.13
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/stretchr/testify v1.5.1
 	golang.org/x/net v0.0.0-20180821023952-922f4815f713
+	golang.org/x/text v0.3.2
 	gopkg.in/gcfg.v1 v1.2.3
 	gopkg.in/warnings.v0 v0.1.2 // indirect
 )
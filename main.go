@@ -12,19 +12,30 @@ modification history
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"os"
+	"os/signal"
 	"path"
+	"syscall"
 	"time"
 
 	"github.com/baidu/go-lib/log"
 	log4go "github.com/baidu/go-lib/log/log4go"
 
+	"github.com/NKztq/spider/cache"
+	"github.com/NKztq/spider/canonicalizer"
+	"github.com/NKztq/spider/checkpoint"
 	"github.com/NKztq/spider/conf"
 	"github.com/NKztq/spider/crawler"
 	"github.com/NKztq/spider/fetcher"
+	"github.com/NKztq/spider/metrics"
 	"github.com/NKztq/spider/outputer"
+	"github.com/NKztq/spider/robots"
+	"github.com/NKztq/spider/scope"
 	"github.com/NKztq/spider/seed"
 )
 
@@ -35,6 +46,7 @@ var (
 	stdOut   *bool   = flag.Bool("s", false, "show log in stdout")
 	showVer  *bool   = flag.Bool("v", false, "show version")
 	debugLog *bool   = flag.Bool("d", false, "show debug level log msg")
+	resume   *bool   = flag.Bool("resume", false, "resume crawling from checkpoint")
 )
 
 var (
@@ -81,30 +93,118 @@ func main() {
 		gracefullyExit(-3)
 	}
 
+	// create directory for tasks spilled to disk
+	if cfg.Crawler.FrontierDirectory != "" {
+		err = os.MkdirAll(cfg.Crawler.FrontierDirectory, os.ModePerm)
+		if err != nil {
+			log.Logger.Error("main(): os.MkdirAll(): %v", err)
+			gracefullyExit(-12)
+		}
+	}
+
 	seeds, err := seed.Load(cfg.Basic.UrlListFile)
 	if err != nil {
 		log.Logger.Error("main(): seed.Load(): %v", err)
 		gracefullyExit(-4)
 	}
 
+	// open cache for conditional requests
+	var fetcherCache fetcher.Cache
+	if cfg.Fetcher.CacheDirectory != "" {
+		c := canonicalizer.NewCanonicalizer(cfg.Crawler.SortQuery, cfg.Crawler.DropQueryParam)
+		fetcherCache, err = cache.Open(cfg.Fetcher.CacheDirectory, c)
+		if err != nil {
+			log.Logger.Error("main(): cache.Open(): %v", err)
+			gracefullyExit(-11)
+		}
+	}
+
 	// create fetcher
-	fetcher := fetcher.NewFetcher(cfg.Fetcher)
+	fetcher := fetcher.NewFetcher(cfg.Fetcher, fetcherCache)
 
 	// create outputer
-	outputer, err := outputer.NewOutputer(cfg.Outputer)
+	output, err := outputer.New(cfg)
 	if err != nil {
-		log.Logger.Error("main(): outputer.NewOutputer(): %v", err)
+		log.Logger.Error("main(): outputer.New(): %v", err)
 		gracefullyExit(-5)
 	}
 
+	// create robots.txt checker
+	var robotsChecker crawler.Robots
+	if cfg.Robots.Enable {
+		// identify as the user agent robots.txt is obeyed for
+		fetcher.SetUserAgent(cfg.Robots.UserAgent)
+		robotsChecker = robots.NewChecker(cfg.Robots, fetcher)
+	}
+
+	// open checkpoint
+	var cp *checkpoint.Checkpoint
+	var crawlerCheckpoint crawler.Checkpoint
+	if cfg.Crawler.CheckpointDirectory != "" {
+		cp, err = checkpoint.Open(cfg.Crawler.CheckpointDirectory, *resume)
+		if err != nil {
+			log.Logger.Error("main(): checkpoint.Open(): %v", err)
+			gracefullyExit(-6)
+		}
+		crawlerCheckpoint = cp
+	} else if *resume {
+		log.Logger.Error("main(): -resume needs checkpointDirectory in config")
+		gracefullyExit(-6)
+	}
+
+	// create scope
+	scope, err := scope.NewScope(cfg.Scope, seeds)
+	if err != nil {
+		log.Logger.Error("main(): scope.NewScope(): %v", err)
+		gracefullyExit(-7)
+	}
+
+	// serve metrics
+	if cfg.Metrics.Enable {
+		err = serveMetrics(cfg.Metrics)
+		if err != nil {
+			log.Logger.Error("main(): serveMetrics(): %v", err)
+			gracefullyExit(-10)
+		}
+	}
+
 	// create crawler
-	crawler := crawler.NewCrawler(cfg.Crawler, seeds, fetcher, outputer)
+	crawler := crawler.NewCrawler(cfg.Crawler, seeds, fetcher, output, robotsChecker, crawlerCheckpoint, scope)
 
-	// run crawler
-	err = crawler.RunOnce()
+	// run crawler, stop on SIGTERM or SIGINT
+	ctx := signalContext()
+	var runErr error
+	if cfg.Crawler.Daemon {
+		runErr = crawler.RunDaemon(ctx)
+	} else {
+		runErr = crawler.RunOnce(ctx)
+	}
+
+	// stopped by signal is a normal stop, pending tasks are kept in checkpoint
+	if errors.Is(runErr, context.Canceled) {
+		log.Logger.Info("main(): crawler stopped by signal")
+		runErr = nil
+	}
+	if runErr != nil {
+		log.Logger.Error("main(): crawler run: %v", runErr)
+	}
+
+	// flush outputs like WARC files and databases, on both normal stop and failure
+	err = output.Close()
 	if err != nil {
-		log.Logger.Error("main(): crawler.RunOnce(): %v", err)
-		gracefullyExit(-6)
+		log.Logger.Error("main(): outputer Close(): %v", err)
+	}
+
+	if cp != nil {
+		err = cp.Close()
+		if err != nil {
+			log.Logger.Error("main(): checkpoint.Close(): %v", err)
+			gracefullyExit(-9)
+		}
+	}
+
+	if runErr != nil {
+		gracefullyExit(-8)
 	}
 
 	gracefullyExit(0)
@@ -138,6 +238,39 @@ func createOutputDirectory(outputDirectory string) error {
 	return err
 }
 
+// Serve metrics in background, returns error if address can not be listened on.
+func serveMetrics(cfg conf.MetricsConf) error {
+	listener, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return fmt.Errorf("address: %s, net.Listen(): %v", cfg.Address, err)
+	}
+
+	server := metrics.NewServer(cfg.Address, cfg.Path)
+	go func() {
+		err := server.Serve(listener)
+		log.Logger.Error("serveMetrics(): server.Serve(): %v", err)
+	}()
+
+	log.Logger.Info("serveMetrics(): serving metrics at %s%s", cfg.Address, cfg.Path)
+
+	return nil
+}
+
+// Get a context which is cancelled when SIGTERM or SIGINT is received.
+func signalContext() context.Context {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		sig := <-sigs
+		log.Logger.Info("signalContext(): received %v, stopping", sig)
+		cancel()
+	}()
+
+	return ctx
+}
+
 func gracefullyExit(code int) {
 	log.Logger.Close()
 
@@ -0,0 +1,23 @@
+// handler.go - serve metrics over HTTP.
+
+package metrics
+
+import (
+	"net/http"
+)
+
+// Handler gets a handler writing all registered metrics in Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		defaultRegistry.write(w)
+	})
+}
+
+// NewServer creates a server serving metrics at path on address, call ListenAndServe() to start it.
+func NewServer(address, path string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(path, Handler())
+
+	return &http.Server{Addr: address, Handler: mux}
+}
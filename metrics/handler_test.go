@@ -0,0 +1,39 @@
+// handler_test.go - UT for handler.go.
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	// metrics of this test only, so that it can run more than once
+	defer func(r *registry) { defaultRegistry = r }(defaultRegistry)
+	defaultRegistry = newTestRegistry()
+
+	c := NewCounter("test_handler_total", "Handler test.")
+	c.Inc()
+
+	ts := httptest.NewServer(NewServer("", "/metrics").Handler)
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/metrics")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain"))
+	assert.Contains(t, string(body), "# TYPE test_handler_total counter\ntest_handler_total 1\n")
+
+	resp, err = ts.Client().Get(ts.URL + "/other")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+}
@@ -0,0 +1,294 @@
+// metrics.go - counters, gauges and histograms exposed in Prometheus text format.
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// a metric in registry
+type metric interface {
+	// Name of metric.
+	name() string
+
+	// Write metric in Prometheus text format.
+	write(w io.Writer)
+}
+
+// registry of all metrics
+type registry struct {
+	lock    sync.Mutex
+	metrics map[string]metric
+}
+
+var defaultRegistry = &registry{metrics: make(map[string]metric)}
+
+// Register m, panics if a metric of the same name exists, like duplicate flags.
+func (r *registry) register(m metric) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.metrics[m.name()]; ok {
+		panic(fmt.Sprintf("metrics: duplicate metric: %s", m.name()))
+	}
+
+	r.metrics[m.name()] = m
+}
+
+// Write all metrics, ordered by name.
+func (r *registry) write(w io.Writer) {
+	// snapshot under lock, register() may add metrics while writing
+	r.lock.Lock()
+	metrics := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.lock.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name() < metrics[j].name() })
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// values of a metric with labels
+type series struct {
+	labelNames []string
+
+	lock   sync.Mutex
+	values map[string]float64 // joined label values => value
+}
+
+func newSeries(labelNames []string) *series {
+	return &series{labelNames: labelNames, values: make(map[string]float64)}
+}
+
+// Update value of labelValues by f.
+func (s *series) update(labelValues []string, f func(float64) float64) {
+	if len(labelValues) != len(s.labelNames) {
+		panic(fmt.Sprintf("metrics: %d label values for %d labels", len(labelValues), len(s.labelNames)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.values[key] = f(s.values[key])
+}
+
+// Get value of labelValues.
+func (s *series) get(labelValues []string) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.values[strings.Join(labelValues, "\xff")]
+}
+
+// Write every value as a line, ordered by labels.
+func (s *series) write(w io.Writer, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var labelValues []string
+		if len(s.labelNames) > 0 {
+			labelValues = strings.Split(key, "\xff")
+		}
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(s.labelNames, labelValues), formatValue(s.values[key]))
+	}
+}
+
+// Counter is a value which only goes up.
+type Counter struct {
+	metricName string
+	help       string
+	series     *series
+}
+
+// NewCounter creates and registers a counter.
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{name, help, newSeries(labelNames)}
+	defaultRegistry.register(c)
+
+	return c
+}
+
+// Inc adds one to counter of labelValues.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v(>= 0) to counter of labelValues.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.series.update(labelValues, func(old float64) float64 { return old + v })
+}
+
+// Value gets value of counter of labelValues.
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.series.get(labelValues)
+}
+
+func (c *Counter) name() string {
+	return c.metricName
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.metricName, c.help, "counter")
+	c.series.write(w, c.metricName)
+}
+
+// Gauge is a value which goes up and down.
+type Gauge struct {
+	metricName string
+	help       string
+	series     *series
+}
+
+// NewGauge creates and registers a gauge.
+func NewGauge(name, help string, labelNames ...string) *Gauge {
+	g := &Gauge{name, help, newSeries(labelNames)}
+	defaultRegistry.register(g)
+
+	return g
+}
+
+// Set sets gauge of labelValues to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.series.update(labelValues, func(float64) float64 { return v })
+}
+
+// Add adds v to gauge of labelValues, v may be negative.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.series.update(labelValues, func(old float64) float64 { return old + v })
+}
+
+// Value gets value of gauge of labelValues.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.series.get(labelValues)
+}
+
+func (g *Gauge) name() string {
+	return g.metricName
+}
+
+func (g *Gauge) write(w io.Writer) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	g.series.write(w, g.metricName)
+}
+
+// Histogram counts observed values in buckets.
+type Histogram struct {
+	metricName string
+	help       string
+	buckets    []float64 // upper bounds, ascending
+
+	lock   sync.Mutex
+	counts []uint64 // count of values in each bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates and registers a histogram, buckets are upper bounds in ascending order.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{
+		metricName: name,
+		help:       help,
+		buckets:    buckets,
+		counts:     make([]uint64, len(buckets)),
+	}
+	defaultRegistry.register(h)
+
+	return h
+}
+
+// Observe adds v to histogram.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count gets count of observed values.
+func (h *Histogram) Count() uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.count
+}
+
+func (h *Histogram) name() string {
+	return h.metricName
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	writeHeader(w, h.metricName, h.help, "histogram")
+
+	cumulative := uint64(0)
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.metricName, formatValue(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.metricName, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.metricName, formatValue(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.metricName, h.count)
+}
+
+// ExponentialBuckets gets count buckets, from start, each factor times of the former.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+
+	return buckets
+}
+
+func writeHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(values[i])
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
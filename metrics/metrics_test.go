@@ -0,0 +1,131 @@
+// metrics_test.go - UT for metrics.go.
+
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRegistry() *registry {
+	return &registry{metrics: make(map[string]metric)}
+}
+
+func TestCounter(t *testing.T) {
+	r := newTestRegistry()
+	c := &Counter{"test_requests_total", "Requests.", newSeries([]string{"code", "method"})}
+	r.register(c)
+
+	c.Inc("200", "GET")
+	c.Add(2, "200", "GET")
+	c.Inc("404", "GET")
+
+	assert.Equal(t, float64(3), c.Value("200", "GET"))
+	assert.Equal(t, float64(1), c.Value("404", "GET"))
+	assert.Equal(t, float64(0), c.Value("500", "GET"))
+
+	var buf bytes.Buffer
+	r.write(&buf)
+
+	expect := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{code="200",method="GET"} 3
+test_requests_total{code="404",method="GET"} 1
+`
+	assert.Equal(t, expect, buf.String())
+}
+
+func TestCounter_WrongLabels(t *testing.T) {
+	c := &Counter{"test_total", "Test.", newSeries([]string{"code"})}
+
+	assert.Panics(t, func() { c.Inc() })
+	assert.Panics(t, func() { c.Inc("200", "GET") })
+}
+
+func TestGauge(t *testing.T) {
+	r := newTestRegistry()
+	g := &Gauge{"test_queue_depth", "Queue depth.", newSeries(nil)}
+	r.register(g)
+
+	g.Set(5)
+	g.Add(-2)
+
+	assert.Equal(t, float64(3), g.Value())
+
+	var buf bytes.Buffer
+	r.write(&buf)
+
+	expect := `# HELP test_queue_depth Queue depth.
+# TYPE test_queue_depth gauge
+test_queue_depth 3
+`
+	assert.Equal(t, expect, buf.String())
+}
+
+func TestHistogram(t *testing.T) {
+	r := newTestRegistry()
+	h := &Histogram{
+		metricName: "test_seconds",
+		help:       "Latency.",
+		buckets:    []float64{0.1, 1},
+		counts:     make([]uint64, 2),
+	}
+	r.register(h)
+
+	h.Observe(0.05)
+	h.Observe(0.1) // upper bound is inclusive
+	h.Observe(0.5)
+	h.Observe(2)
+
+	assert.Equal(t, uint64(4), h.Count())
+
+	var buf bytes.Buffer
+	r.write(&buf)
+
+	expect := `# HELP test_seconds Latency.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1"} 2
+test_seconds_bucket{le="1"} 3
+test_seconds_bucket{le="+Inf"} 4
+test_seconds_sum 2.65
+test_seconds_count 4
+`
+	assert.Equal(t, expect, buf.String())
+}
+
+func TestRegister_Duplicate(t *testing.T) {
+	r := newTestRegistry()
+	r.register(&Gauge{"test_gauge", "Test.", newSeries(nil)})
+
+	assert.Panics(t, func() {
+		r.register(&Gauge{"test_gauge", "Test.", newSeries(nil)})
+	})
+}
+
+func TestRegistry_Ordered(t *testing.T) {
+	r := newTestRegistry()
+	b := &Gauge{"test_b", "B.", newSeries(nil)}
+	a := &Gauge{"test_a", "A.", newSeries(nil)}
+	r.register(b)
+	r.register(a)
+	b.Set(2)
+	a.Set(1)
+
+	var buf bytes.Buffer
+	r.write(&buf)
+
+	expect := `# HELP test_a A.
+# TYPE test_a gauge
+test_a 1
+# HELP test_b B.
+# TYPE test_b gauge
+test_b 2
+`
+	assert.Equal(t, expect, buf.String())
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	assert.Equal(t, []float64{0.5, 1, 2, 4}, ExponentialBuckets(0.5, 2, 4))
+}
@@ -0,0 +1,74 @@
+// compress.go - compress saved bodies by codec in config.
+
+package outputer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/NKztq/spider/conf"
+)
+
+// compressor compresses bodies before saved, bodies are saved as-is if codec is empty.
+// Names of saved files get suffix of codec, like ".gz", and are read by package reader, which detects codec by suffix.
+type compressor struct {
+	codec  string
+	suffix string        // suffix of file names, same as package reader
+	level  int           // level of gzip
+	zstd   *zstd.Encoder // shared by goroutines
+}
+
+func newCompressor(cfg conf.OutputerConf) (*compressor, error) {
+	c := &compressor{codec: cfg.Compression, level: cfg.CompressionLevel}
+
+	switch cfg.Compression {
+	case "":
+	case "gzip":
+		c.suffix = ".gz"
+		if c.level == 0 {
+			c.level = gzip.DefaultCompression
+		}
+	case "zstd":
+		c.suffix = ".zst"
+		level := zstd.SpeedDefault
+		if cfg.CompressionLevel != 0 {
+			level = zstd.EncoderLevelFromZstd(cfg.CompressionLevel)
+		}
+
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+		if err != nil {
+			return nil, fmt.Errorf("zstd.NewWriter(): %v", err)
+		}
+		c.zstd = encoder
+	default:
+		return nil, fmt.Errorf("invalid compression: %s", cfg.Compression)
+	}
+
+	return c, nil
+}
+
+// Compress content by codec.
+func (c *compressor) compress(content []byte) ([]byte, error) {
+	switch c.codec {
+	case "gzip":
+		var buf bytes.Buffer
+		gz, err := gzip.NewWriterLevel(&buf, c.level)
+		if err != nil {
+			return nil, fmt.Errorf("gzip.NewWriterLevel(): %v", err)
+		}
+
+		gz.Write(content)
+		if err := gz.Close(); err != nil {
+			return nil, fmt.Errorf("gzip.Close(): %v", err)
+		}
+
+		return buf.Bytes(), nil
+	case "zstd":
+		return c.zstd.EncodeAll(content, nil), nil
+	}
+
+	return content, nil
+}
@@ -0,0 +1,60 @@
+// compress_test.go - UT for compress.go.
+
+package outputer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/reader"
+)
+
+func TestCompressor(t *testing.T) {
+	body := []byte(strings.Repeat("<html>hello</html>", 100))
+
+	for _, cfg := range []conf.OutputerConf{
+		{},
+		{Compression: "gzip"},
+		{Compression: "gzip", CompressionLevel: 9},
+		{Compression: "zstd"},
+		{Compression: "zstd", CompressionLevel: 19},
+	} {
+		c, err := newCompressor(cfg)
+		assert.NoError(t, err)
+
+		content, err := c.compress(body)
+		assert.NoError(t, err)
+		if cfg.Compression == "" {
+			assert.Equal(t, body, content)
+		} else {
+			assert.True(t, len(content) < len(body)/5, cfg.Compression)
+		}
+
+		// suffix same as reader
+		assert.Equal(t, reader.Suffix(cfg.Compression), c.suffix)
+
+		// read back by codec
+		r, err := reader.NewReader(bytes.NewReader(content), cfg.Compression)
+		assert.NoError(t, err)
+		data, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.NoError(t, r.Close())
+		assert.Equal(t, body, data, cfg.Compression)
+	}
+}
+
+func TestCompressor_Invalid(t *testing.T) {
+	_, err := newCompressor(conf.OutputerConf{Compression: "lz4"})
+	assert.EqualError(t, err, "invalid compression: lz4")
+
+	// level is checked by config
+	c, err := newCompressor(conf.OutputerConf{Compression: "gzip", CompressionLevel: 10})
+	assert.NoError(t, err)
+	_, err = c.compress([]byte("test"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,326 @@
+// hierarchical.go - output bodies in directories mirroring URLs.
+
+package outputer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/baidu/go-lib/log"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+)
+
+const (
+	indexFileName    = "index.html"     // file name of directory URLs like "http://host/a/"
+	manifestFileName = "manifest.jsonl" // maps every saved file to its URL, in output directory
+	hashDirectory    = ".hash"          // files of URLs which can not be mirrored, sharded by digest of URL, never a host
+	manifestMaxLine  = 1 << 20          // max length of a manifest line, in bytes
+)
+
+// a line of manifest
+type manifestRecord struct {
+	File string `json:"file"` // path relative to output directory, separated by "/"
+	URL  string `json:"url"`
+}
+
+// HierarchicalOutputer saves bodies in directories laid out as host/path,
+// like "http://www.baidu.com/a/b.html" in OutputDirectory/www.baidu.com/a/b.html.
+// URLs which can not be mirrored, for too long segments or colliding with saved files,
+// are saved in sharded directories by SHA-256 of URL, like .hash/ab/cd/abcd....
+// Every saved file is recorded in manifest, which is loaded again on restart, so that a URL keeps its file.
+// Compressed files are named with suffix of codec, like b.html.gz, which is not recorded in manifest.
+type HierarchicalOutputer struct {
+	OutputDirectory string
+	Pattern         *regexp.Regexp
+	SaveMetadata    bool     // save metadata alongside body or not
+	AllowedMIME     []string // glob patterns of media types to save, all saved if empty
+
+	compressor *compressor
+
+	lock     sync.Mutex
+	manifest *os.File
+	files    map[string]string // relative path => URL, of saved files and their metadata files
+	dirs     map[string]bool   // relative paths of directories holding saved files
+	paths    map[string]string // URL => relative path of saved file
+}
+
+func init() {
+	Register("hierarchical", func(cfg conf.Config) (Backend, error) {
+		return NewHierarchicalOutputer(cfg.Outputer)
+	})
+}
+
+func NewHierarchicalOutputer(cfg conf.OutputerConf) (*HierarchicalOutputer, error) {
+	pattern, err := regexp.Compile(cfg.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("url: %s, regexp.Compile(): %v", cfg.TargetURL, err)
+	}
+
+	err = os.MkdirAll(cfg.OutputDirectory, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("directory: %s, os.MkdirAll(): %v", cfg.OutputDirectory, err)
+	}
+
+	compressor, err := newCompressor(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &HierarchicalOutputer{
+		OutputDirectory: cfg.OutputDirectory,
+		Pattern:         pattern,
+		SaveMetadata:    cfg.SaveMetadata,
+		AllowedMIME:     cfg.AllowedMIME,
+		compressor:      compressor,
+		files:           map[string]string{manifestFileName: ""},
+		dirs:            make(map[string]bool),
+		paths:           make(map[string]string),
+	}
+
+	fp := filepath.Join(cfg.OutputDirectory, manifestFileName)
+	err = o.loadManifest(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	o.manifest, err = os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(): fp: %s, err: %v", fp, err)
+	}
+
+	return o, nil
+}
+
+// Output body of res into file whose path mirrors final URL of res, compressed by codec in config
+// into file named with suffix of codec, like ".gz", and metadata of res into file named by it and metadataSuffix if SaveMetadata is set.
+func (o *HierarchicalOutputer) OutputFile(fileName string, res *fetcher.FetchResult) error {
+	if !accepted(o.Pattern, o.AllowedMIME, fileName, res) {
+		return nil
+	}
+
+	o.lock.Lock()
+	rel, err := o.place(res.FinalURL)
+	o.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	fp := filepath.Join(o.OutputDirectory, filepath.FromSlash(rel))
+
+	err = os.MkdirAll(filepath.Dir(fp), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("directory: %s, os.MkdirAll(): %v", filepath.Dir(fp), err)
+	}
+
+	content, err := o.compressor.compress(res.Body)
+	if err != nil {
+		return fmt.Errorf("url: %s, compress(): %v", res.FinalURL, err)
+	}
+
+	err = writeFile(fp+o.compressor.suffix, content)
+	if err != nil {
+		return err
+	}
+
+	filesWritten.Inc()
+
+	if o.SaveMetadata {
+		metadata, err := encodeMetadata(res)
+		if err != nil {
+			return fmt.Errorf("url: %s, encodeMetadata(): %v", res.FinalURL, err)
+		}
+
+		err = writeFile(fp+metadataSuffix, metadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Logger.Info("OutputFile(): url: %s output to %s successfully", res.FinalURL, rel)
+
+	return nil
+}
+
+// Saved checks whether file of final URL of res is recorded in manifest and still in output directory.
+func (o *HierarchicalOutputer) Saved(fileName string, res *fetcher.FetchResult) bool {
+	o.lock.Lock()
+	rel, ok := o.paths[res.FinalURL]
+	o.lock.Unlock()
+	if !ok {
+		return false
+	}
+
+	_, err := os.Stat(filepath.Join(o.OutputDirectory, filepath.FromSlash(rel)) + o.compressor.suffix)
+
+	return err == nil
+}
+
+// Close closes manifest.
+func (o *HierarchicalOutputer) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return o.manifest.Close()
+}
+
+// Load files saved by previous runs from manifest of path fp, if exists.
+func (o *HierarchicalOutputer) loadManifest(fp string) error {
+	f, err := os.Open(fp)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("os.Open(): fp: %s, err: %v", fp, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 4096), manifestMaxLine)
+	for scanner.Scan() {
+		var record manifestRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// last line may be broken by crash
+			log.Logger.Warn("loadManifest(): fp: %s, json.Unmarshal(): %v", fp, err)
+			continue
+		}
+		o.assign(record.File, record.URL)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("fp: %s, scanner.Scan(): %v", fp, err)
+	}
+
+	return nil
+}
+
+// Get relative path of file for rawURL, a new file is recorded in manifest. Should be called with o.lock held.
+func (o *HierarchicalOutputer) place(rawURL string) (string, error) {
+	if rel, ok := o.paths[rawURL]; ok {
+		return rel, nil
+	}
+
+	rel, err := mirrorPath(rawURL)
+	if err != nil || !o.free(rel) {
+		rel = hashedPath(rawURL)
+	}
+
+	line, err := json.Marshal(manifestRecord{rel, rawURL})
+	if err != nil {
+		return "", fmt.Errorf("url: %s, json.Marshal(): %v", rawURL, err)
+	}
+
+	// one write per line, so that lines are never interleaved
+	_, err = o.manifest.Write(append(line, '\n'))
+	if err != nil {
+		return "", fmt.Errorf("write to file: %s failed, err: %v", o.manifest.Name(), err)
+	}
+
+	o.assign(rel, rawURL)
+
+	return rel, nil
+}
+
+// Record file of relative path rel saved for rawURL, with its compressed and metadata files.
+// Should be called with o.lock held.
+func (o *HierarchicalOutputer) assign(rel, rawURL string) {
+	o.files[rel] = rawURL
+	o.files[rel+o.compressor.suffix] = rawURL
+	o.files[rel+metadataSuffix] = rawURL
+	o.paths[rawURL] = rel
+
+	for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		o.dirs[dir] = true
+	}
+}
+
+// Check whether file of relative path rel can be saved without colliding with saved files,
+// their compressed and metadata files and directories. Should be called with o.lock held.
+func (o *HierarchicalOutputer) free(rel string) bool {
+	if _, ok := o.files[rel]; ok {
+		return false
+	}
+	if _, ok := o.files[rel+o.compressor.suffix]; ok {
+		return false
+	}
+	if _, ok := o.files[rel+metadataSuffix]; ok {
+		return false
+	}
+	if o.dirs[rel] {
+		return false
+	}
+
+	// a saved file can not be a directory
+	for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if _, ok := o.files[dir]; ok {
+			return false
+		}
+	}
+
+	// directories not recorded, like created by hand
+	info, err := os.Stat(filepath.Join(o.OutputDirectory, filepath.FromSlash(rel)))
+	if err == nil && info.IsDir() {
+		return false
+	}
+
+	return true
+}
+
+// Get relative path of file mirroring rawURL, separated by "/", like "www.baidu.com/a/b.html".
+// Directory URLs are saved as index.html, query is kept in the last segment escaped.
+// Error is returned if rawURL can not be mirrored, like a segment is too long.
+func mirrorPath(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("url: %s, url.Parse(): %v", rawURL, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("url: %s, empty host", rawURL)
+	}
+	// like ".." and hashDirectory
+	if strings.HasPrefix(u.Host, ".") {
+		return "", fmt.Errorf("url: %s, invalid host: %s", rawURL, u.Host)
+	}
+
+	// dot segments are resolved, so that files never escape output directory
+	escapedPath := u.EscapedPath()
+	segments := strings.Split(strings.TrimPrefix(path.Clean("/"+escapedPath), "/"), "/")
+	if escapedPath == "" || strings.HasSuffix(escapedPath, "/") || segments[len(segments)-1] == "" {
+		segments = append(segments, indexFileName)
+	}
+	if segments[0] == "" {
+		segments = segments[1:]
+	}
+
+	if u.RawQuery != "" {
+		segments[len(segments)-1] += url.QueryEscape("?" + u.RawQuery)
+	}
+
+	segments = append([]string{url.PathEscape(u.Host)}, segments...)
+	for _, segment := range segments {
+		// room for metadata file
+		if len(segment)+len(metadataSuffix) > fileNameMaxLength {
+			return "", fmt.Errorf("url: %s, segment too long: %s", rawURL, segment)
+		}
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// Get relative path of file for rawURL in sharded hash directories, like ".hash/ab/cd/abcd...".
+func hashedPath(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	hashed := hex.EncodeToString(sum[:])
+
+	return path.Join(hashDirectory, hashed[:2], hashed[2:4], hashed)
+}
@@ -0,0 +1,242 @@
+// hierarchical_test.go - UT for hierarchical.go.
+
+package outputer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+	"github.com/NKztq/spider/reader"
+)
+
+func TestMirrorPath(t *testing.T) {
+	cases := map[string]string{
+		"http://www.baidu.com":                "www.baidu.com/index.html",
+		"http://www.baidu.com/":               "www.baidu.com/index.html",
+		"http://www.baidu.com/a/":             "www.baidu.com/a/index.html",
+		"http://www.baidu.com/a/b.html":       "www.baidu.com/a/b.html",
+		"http://www.baidu.com/a/b.html?q=1&p": "www.baidu.com/a/b.html%3Fq%3D1%26p",
+		"http://www.baidu.com/?q=1":           "www.baidu.com/index.html%3Fq%3D1",
+		"http://www.baidu.com:8080/a":         "www.baidu.com:8080/a",
+		"http://www.baidu.com/a/../../../etc": "www.baidu.com/etc",
+		"http://www.baidu.com/a%2Fb/c":        "www.baidu.com/a%2Fb/c",
+	}
+
+	for rawURL, expect := range cases {
+		rel, err := mirrorPath(rawURL)
+		assert.NoError(t, err, rawURL)
+		assert.Equal(t, expect, rel, rawURL)
+	}
+
+	for _, rawURL := range []string{
+		"/a/b.html",
+		"http://../a",
+		"http://www.baidu.com/" + strings.Repeat("a", fileNameMaxLength-len(metadataSuffix)+1),
+	} {
+		_, err := mirrorPath(rawURL)
+		assert.Error(t, err, rawURL)
+	}
+}
+
+func TestHashedPath(t *testing.T) {
+	rel := hashedPath("http://www.baidu.com/a")
+	assert.Regexp(t, `^\.hash/([0-9a-f]{2})/([0-9a-f]{2})/[0-9a-f]{64}$`, rel)
+
+	parts := strings.Split(rel, "/")
+	assert.True(t, strings.HasPrefix(parts[3], parts[1]+parts[2]))
+	assert.NotEqual(t, rel, hashedPath("http://www.baidu.com/b"))
+}
+
+// Read manifest as file => URL.
+func readManifest(t *testing.T, directory string) map[string]string {
+	data, err := ioutil.ReadFile(filepath.Join(directory, manifestFileName))
+	assert.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		var record manifestRecord
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		files[record.File] = record.URL
+	}
+
+	return files
+}
+
+func newHierarchicalTestResult(rawURL string) *fetcher.FetchResult {
+	return &fetcher.FetchResult{URL: rawURL, FinalURL: rawURL, StatusCode: 200, Body: []byte(rawURL)}
+}
+
+func TestHierarchicalOutputer(t *testing.T) {
+	directory, err := ioutil.TempDir("", "hierarchical")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	o, err := NewHierarchicalOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*", SaveMetadata: true})
+	assert.NoError(t, err)
+
+	res := newHierarchicalTestResult("http://www.baidu.com/a/b.html")
+	assert.NoError(t, o.OutputFile("http%3A%2F%2Fwww.baidu.com%2Fa%2Fb.html", res))
+	// saved again to the same file
+	assert.NoError(t, o.OutputFile("http%3A%2F%2Fwww.baidu.com%2Fa%2Fb.html", res))
+	assert.NoError(t, o.Close())
+
+	body, err := ioutil.ReadFile(filepath.Join(directory, "www.baidu.com", "a", "b.html"))
+	assert.NoError(t, err)
+	assert.Equal(t, res.FinalURL, string(body))
+
+	metadata, err := ioutil.ReadFile(filepath.Join(directory, "www.baidu.com", "a", "b.html"+metadataSuffix))
+	assert.NoError(t, err)
+	assert.Contains(t, string(metadata), `"final_url": "http://www.baidu.com/a/b.html"`)
+
+	assert.Equal(t, map[string]string{"www.baidu.com/a/b.html": res.FinalURL}, readManifest(t, directory))
+}
+
+func TestHierarchicalOutputer_Collision(t *testing.T) {
+	directory, err := ioutil.TempDir("", "hierarchical")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	o, err := NewHierarchicalOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*"})
+	assert.NoError(t, err)
+
+	longURL := "http://www.baidu.com/" + strings.Repeat("a", 300)
+	mirrored := map[string]string{
+		"http://www.baidu.com/a":     "www.baidu.com/a",
+		"http://www.baidu.com/b/c":   "www.baidu.com/b/c",
+		"http://www.baidu.com/d?e":   "www.baidu.com/d%3Fe",
+		"http://www.baidu.com/f":     "www.baidu.com/f",
+		"http://manifest.jsonl.com/": "manifest.jsonl.com/index.html",
+	}
+	hashed := []string{
+		"http://www.baidu.com/a/b",         // file as directory
+		"http://www.baidu.com/b",           // directory as file
+		"http://www.baidu.com/d%3Fe",       // same as escaped query
+		"http://www.baidu.com/f.meta.json", // metadata of another file
+		"http://manifest.jsonl",            // manifest
+		"http://.hash/",                    // hash directory
+		longURL,                            // too long segment
+	}
+
+	for _, rawURL := range []string{
+		"http://www.baidu.com/a", "http://www.baidu.com/a/b",
+		"http://www.baidu.com/b/c", "http://www.baidu.com/b",
+		"http://www.baidu.com/d?e", "http://www.baidu.com/d%3Fe",
+		"http://www.baidu.com/f", "http://www.baidu.com/f.meta.json",
+		"http://manifest.jsonl.com/", "http://manifest.jsonl", "http://.hash/",
+		longURL,
+	} {
+		assert.NoError(t, o.OutputFile(rawURL, newHierarchicalTestResult(rawURL)), rawURL)
+	}
+	assert.NoError(t, o.Close())
+
+	expects := make(map[string]string)
+	for rawURL, rel := range mirrored {
+		expects[rel] = rawURL
+	}
+	for _, rawURL := range hashed {
+		expects[hashedPath(rawURL)] = rawURL
+	}
+	assert.Equal(t, expects, readManifest(t, directory))
+
+	// every URL is saved in its own file
+	for rel, rawURL := range expects {
+		body, err := ioutil.ReadFile(filepath.Join(directory, filepath.FromSlash(rel)))
+		assert.NoError(t, err, rel)
+		assert.Equal(t, rawURL, string(body), rel)
+	}
+}
+
+func TestHierarchicalOutputer_Reopen(t *testing.T) {
+	directory, err := ioutil.TempDir("", "hierarchical")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	cfg := conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*"}
+	o, err := NewHierarchicalOutputer(cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, o.OutputFile("a", newHierarchicalTestResult("http://www.baidu.com/a")))
+	assert.NoError(t, o.OutputFile("a/b", newHierarchicalTestResult("http://www.baidu.com/a/b")))
+	assert.NoError(t, o.Close())
+
+	// files of previous run are loaded from manifest, broken line skipped
+	f, err := os.OpenFile(filepath.Join(directory, manifestFileName), os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString("{\"file\":\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	o, err = NewHierarchicalOutputer(cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, o.OutputFile("a/b", newHierarchicalTestResult("http://www.baidu.com/a/b")))
+	assert.NoError(t, o.OutputFile("a/c", newHierarchicalTestResult("http://www.baidu.com/a/c")))
+	assert.NoError(t, o.Close())
+
+	// a/b keeps its file, a/c collides with a as well
+	assert.Equal(t, map[string]string{
+		"http://www.baidu.com/a":   "www.baidu.com/a",
+		"http://www.baidu.com/a/b": hashedPath("http://www.baidu.com/a/b"),
+		"http://www.baidu.com/a/c": hashedPath("http://www.baidu.com/a/c"),
+	}, o.paths)
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, manifestFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(data), "\n"))
+}
+
+func TestHierarchicalOutputer_Saved(t *testing.T) {
+	directory, err := ioutil.TempDir("", "hierarchical")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	o, err := NewHierarchicalOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*"})
+	assert.NoError(t, err)
+	defer o.Close()
+
+	res := newHierarchicalTestResult("http://www.baidu.com/a/b.html")
+	assert.False(t, o.Saved("a", res))
+	assert.NoError(t, o.OutputFile("a", res))
+	assert.True(t, o.Saved("a", res))
+
+	// recorded in manifest but file removed
+	assert.NoError(t, os.Remove(filepath.Join(directory, "www.baidu.com", "a", "b.html")))
+	assert.False(t, o.Saved("a", res))
+}
+
+func TestHierarchicalOutputer_Compression(t *testing.T) {
+	directory, err := ioutil.TempDir("", "hierarchical")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	o, err := NewHierarchicalOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*", Compression: "gzip"})
+	assert.NoError(t, err)
+
+	res := newHierarchicalTestResult("http://www.baidu.com/a/b.html")
+	assert.NoError(t, o.OutputFile("b.html", res))
+	assert.NoError(t, o.Close())
+
+	// codec is recorded by suffix
+	fp := filepath.Join(directory, "www.baidu.com", "a", "b.html")
+	fData, err := ioutil.ReadFile(fp + ".gz")
+	assert.NoError(t, err)
+	assert.NotEqual(t, res.Body, fData)
+	assert.True(t, o.Saved("b.html", res))
+
+	data, err := reader.ReadFile(fp)
+	assert.NoError(t, err)
+	assert.Equal(t, res.Body, data)
+
+	// URL mirrored as the compressed file of another one
+	o, err = NewHierarchicalOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*", Compression: "gzip"})
+	assert.NoError(t, err)
+	assert.NoError(t, o.OutputFile("b.html.gz", newHierarchicalTestResult("http://www.baidu.com/a/b.html.gz")))
+	assert.NoError(t, o.Close())
+	assert.Equal(t, hashedPath("http://www.baidu.com/a/b.html.gz"), o.paths["http://www.baidu.com/a/b.html.gz"])
+}
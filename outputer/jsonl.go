@@ -0,0 +1,103 @@
+// jsonl.go - output fetched results as a JSON Lines stream.
+
+package outputer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/baidu/go-lib/log"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+)
+
+// one line of JSON Lines stream
+type jsonlRecord struct {
+	Metadata
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`        // body if it is valid UTF-8
+	BodyBase64 []byte      `json:"body_base64,omitempty"` // body in base64 otherwise
+}
+
+// JSONLOutputer appends every fetched result as one JSON line, with metadata, headers and body.
+type JSONLOutputer struct {
+	Pattern     *regexp.Regexp
+	AllowedMIME []string // glob patterns of media types to save, all saved if empty
+
+	lock sync.Mutex
+	file *os.File
+}
+
+func init() {
+	Register("jsonl", func(cfg conf.Config) (Backend, error) {
+		return NewJSONLOutputer(cfg.Outputer, cfg.OutputerJSONL)
+	})
+}
+
+func NewJSONLOutputer(cfg conf.OutputerConf, jsonlCfg conf.JSONLOutputerConf) (*JSONLOutputer, error) {
+	pattern, err := regexp.Compile(cfg.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("url: %s, regexp.Compile(): %v", cfg.TargetURL, err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(jsonlCfg.File), os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("directory: %s, os.MkdirAll(): %v", filepath.Dir(jsonlCfg.File), err)
+	}
+
+	file, err := os.OpenFile(jsonlCfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(): fp: %s, err: %v", jsonlCfg.File, err)
+	}
+
+	return &JSONLOutputer{Pattern: pattern, AllowedMIME: cfg.AllowedMIME, file: file}, nil
+}
+
+// Append res as one line.
+func (o *JSONLOutputer) OutputFile(fileName string, res *fetcher.FetchResult) error {
+	if !accepted(o.Pattern, o.AllowedMIME, fileName, res) {
+		return nil
+	}
+
+	record := jsonlRecord{Metadata: newMetadata(res), Header: res.Header}
+	if utf8.Valid(res.Body) {
+		record.Body = string(res.Body)
+	} else {
+		record.BodyBase64 = res.Body
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("url: %s, json.Marshal(): %v", res.FinalURL, err)
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	// one write per line, so that lines are never interleaved
+	_, err = o.file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("write to file: %s failed, err: %v", o.file.Name(), err)
+	}
+
+	filesWritten.Inc()
+
+	log.Logger.Info("OutputFile(): url: %s output successfully", fileName)
+
+	return nil
+}
+
+// Close closes JSON Lines file.
+func (o *JSONLOutputer) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return o.file.Close()
+}
@@ -0,0 +1,67 @@
+// jsonl_test.go - UT for jsonl.go.
+
+package outputer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+)
+
+func TestJSONLOutputer(t *testing.T) {
+	directory, err := ioutil.TempDir("", "jsonl")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	fp := path.Join(directory, "out", "pages.jsonl")
+	o, err := NewJSONLOutputer(conf.OutputerConf{TargetURL: ".*.(htm|html)$"}, conf.JSONLOutputerConf{File: fp})
+	assert.NoError(t, err)
+
+	assert.NoError(t, o.OutputFile("a.html", &fetcher.FetchResult{
+		FinalURL:   "http://www.baidu.com/a.html",
+		StatusCode: 200,
+		Header:     http.Header{"Etag": {"abc"}},
+		Body:       []byte("<html>hello</html>"),
+	}))
+	assert.NoError(t, o.OutputFile("b.html", &fetcher.FetchResult{FinalURL: "http://www.baidu.com/b.html", Body: []byte{0xff, 0xfe}}))
+	assert.NoError(t, o.OutputFile("c.jpg", &fetcher.FetchResult{FinalURL: "http://www.baidu.com/c.jpg"}))
+	assert.NoError(t, o.Close())
+
+	// appended to existing file
+	o, err = NewJSONLOutputer(conf.OutputerConf{TargetURL: ".*"}, conf.JSONLOutputerConf{File: fp})
+	assert.NoError(t, err)
+	assert.NoError(t, o.OutputFile("d.html", &fetcher.FetchResult{FinalURL: "http://www.baidu.com/d.html"}))
+	assert.NoError(t, o.Close())
+
+	data, err := ioutil.ReadFile(fp)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	assert.Len(t, lines, 3)
+
+	var record jsonlRecord
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "http://www.baidu.com/a.html", record.FinalURL)
+	assert.Equal(t, 200, record.StatusCode)
+	assert.Equal(t, "abc", record.Header.Get("ETag"))
+	assert.Equal(t, "<html>hello</html>", record.Body)
+	assert.Empty(t, record.BodyBase64)
+
+	// invalid UTF-8 in base64
+	record = jsonlRecord{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Empty(t, record.Body)
+	assert.Equal(t, []byte{0xff, 0xfe}, record.BodyBase64)
+
+	record = jsonlRecord{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[2]), &record))
+	assert.Equal(t, "http://www.baidu.com/d.html", record.FinalURL)
+}
@@ -0,0 +1,59 @@
+// metadata.go - metadata of fetched pages, saved alongside bodies.
+
+package outputer
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/NKztq/spider/fetcher"
+)
+
+const (
+	metadataSuffix = ".meta.json" // suffix of metadata file name
+)
+
+// Metadata is saved as JSON in file named by body's file name and metadataSuffix.
+type Metadata struct {
+	URL          string             `json:"url"`
+	FinalURL     string             `json:"final_url"`
+	Redirects    []fetcher.Redirect `json:"redirects,omitempty"`
+	StatusCode   int                `json:"status_code"`
+	ContentType  string             `json:"content_type,omitempty"`
+	Charset      string             `json:"charset,omitempty"` // charset of original body
+	Transcoded   bool               `json:"transcoded,omitempty"`
+	LastModified string             `json:"last_modified,omitempty"` // in HTTP date format
+	ETag         string             `json:"etag,omitempty"`
+	Length       int                `json:"length"`
+	FetchedAt    time.Time          `json:"fetched_at"`
+	DurationMS   int64              `json:"duration_ms"`
+}
+
+// Get metadata of res.
+func newMetadata(res *fetcher.FetchResult) Metadata {
+	m := Metadata{
+		URL:         res.URL,
+		FinalURL:    res.FinalURL,
+		Redirects:   res.Redirects,
+		StatusCode:  res.StatusCode,
+		ContentType: res.ContentType,
+		Charset:     res.Charset,
+		Transcoded:  res.Transcoded,
+		ETag:        res.ETag,
+		Length:      len(res.Body),
+		FetchedAt:   res.FetchedAt,
+		DurationMS:  int64(res.Duration / time.Millisecond),
+	}
+
+	if !res.LastModified.IsZero() {
+		m.LastModified = res.LastModified.UTC().Format(http.TimeFormat)
+	}
+
+	return m
+}
+
+// Encode metadata of res as JSON.
+func encodeMetadata(res *fetcher.FetchResult) ([]byte, error) {
+	return json.MarshalIndent(newMetadata(res), "", "  ")
+}
@@ -0,0 +1,46 @@
+// metadata_test.go - UT for metadata.go.
+
+package outputer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/fetcher"
+)
+
+func TestNewMetadata(t *testing.T) {
+	fetchedAt := time.Date(2020, 3, 2, 16, 0, 0, 0, time.UTC)
+	res := &fetcher.FetchResult{
+		URL:          "http://www.baidu.com",
+		FinalURL:     "https://www.baidu.com/",
+		Redirects:    []fetcher.Redirect{{URL: "http://www.baidu.com", StatusCode: 301}},
+		StatusCode:   200,
+		ContentType:  "text/html",
+		Charset:      "utf-8",
+		LastModified: time.Date(2020, 3, 1, 8, 0, 0, 0, time.FixedZone("CST", 8*3600)),
+		Body:         []byte("test"),
+		FetchedAt:    fetchedAt,
+		Duration:     1500 * time.Millisecond,
+	}
+
+	expect := Metadata{
+		URL:          "http://www.baidu.com",
+		FinalURL:     "https://www.baidu.com/",
+		Redirects:    []fetcher.Redirect{{URL: "http://www.baidu.com", StatusCode: 301}},
+		StatusCode:   200,
+		ContentType:  "text/html",
+		Charset:      "utf-8",
+		LastModified: "Sun, 01 Mar 2020 00:00:00 GMT",
+		Length:       4,
+		FetchedAt:    fetchedAt,
+		DurationMS:   1500,
+	}
+	assert.Equal(t, expect, newMetadata(res))
+
+	// absent Last-Modified is omitted
+	res.LastModified = time.Time{}
+	assert.Equal(t, "", newMetadata(res).LastModified)
+}
@@ -0,0 +1,14 @@
+// metrics.go - metrics of outputer.
+
+package outputer
+
+import (
+	"github.com/NKztq/spider/metrics"
+)
+
+var (
+	filesWritten = metrics.NewCounter("spider_files_written_total",
+		"Number of files written by outputer.")
+	bodiesDeduplicated = metrics.NewCounter("spider_bodies_deduplicated_total",
+		"Number of bodies not written again, for saved by content-addressed outputer already.")
+)
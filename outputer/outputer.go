@@ -3,26 +3,38 @@
 package outputer
 
 import (
-	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 
 	"github.com/baidu/go-lib/log"
 
 	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+	"github.com/NKztq/spider/reader"
 )
 
 const (
 	fileNameMaxLength = 255 // in Bytes, Linux&MacOS's max file name length
-	md5HashLength     = 32
+
+	tempFilePrefix   = ".tmp-"   // prefix of temp files, renamed once written
+	objectsDirectory = "objects" // directory of bodies saved by SHA-256, in output directory
+	digestSuffix     = ".sha256" // suffix of file recording SHA-256 of body
 )
 
 type Outputer struct {
-	OutputDirectory string
-	Pattern         *regexp.Regexp
+	OutputDirectory  string
+	Pattern          *regexp.Regexp
+	SaveMetadata     bool     // save metadata alongside body or not
+	AllowedMIME      []string // glob patterns of media types to save, all saved if empty
+	ContentAddressed bool     // save bodies by SHA-256 in objectsDirectory, and digests in files named by URLs
+
+	compressor *compressor
 }
 
 func NewOutputer(cfg conf.OutputerConf) (*Outputer, error) {
@@ -31,19 +43,32 @@ func NewOutputer(cfg conf.OutputerConf) (*Outputer, error) {
 		return nil, fmt.Errorf("url: %s, regexp.Compile(): %v", cfg.TargetURL, err)
 	}
 
-	return &Outputer{cfg.OutputDirectory, pattern}, nil
+	compressor, err := newCompressor(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Outputer{
+		OutputDirectory:  cfg.OutputDirectory,
+		Pattern:          pattern,
+		SaveMetadata:     cfg.SaveMetadata,
+		AllowedMIME:      cfg.AllowedMIME,
+		ContentAddressed: cfg.ContentAddressed,
+		compressor:       compressor,
+	}, nil
 }
 
-// Output content into file whose path is joined by Outputer's outputDirectory and fileName.
-// FileNames that match failed will not output.
-func (o *Outputer) OutputFile(fileName string, content []byte) error {
-	if !o.Pattern.MatchString(fileName) {
-		log.Logger.Info("OutputFile(): url: %s match failed", fileName)
+// Output body of res into file whose path is joined by Outputer's outputDirectory and fileName,
+// and metadata of res into file named by fileName and metadataSuffix if SaveMetadata is set.
+// If ContentAddressed is set, body is saved once by its SHA-256, and file named by fileName and digestSuffix
+// records the SHA-256 instead. Body is compressed by codec in config into file named with suffix of codec, like ".gz",
+// and can be read by package reader.
+// FileNames that match failed and media types not allowed will not output.
+func (o *Outputer) OutputFile(fileName string, res *fetcher.FetchResult) error {
+	if !accepted(o.Pattern, o.AllowedMIME, fileName, res) {
 		return nil
 	}
 
-	fileName = hashLongFileName(fileName)
-
 	var err error
 
 	_, err = os.Stat(o.OutputDirectory)
@@ -59,39 +84,194 @@ func (o *Outputer) OutputFile(fileName string, content []byte) error {
 		}
 	}
 
-	fp := path.Join(o.OutputDirectory, fileName)
+	if o.ContentAddressed {
+		err = o.writeObject(fileName, res.Body)
+	} else {
+		err = o.writeBody(fileName, res.Body)
+	}
+	if err != nil {
+		return err
+	}
+
+	filesWritten.Inc()
+
+	if o.SaveMetadata {
+		metadata, err := encodeMetadata(res)
+		if err != nil {
+			return fmt.Errorf("url: %s, encodeMetadata(): %v", fileName, err)
+		}
+
+		err = o.writeFile(suffixedFileName(fileName, metadataSuffix), metadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Logger.Info("OutputFile(): url: %s output successfully", fileName)
+
+	return nil
+}
+
+// Close does nothing, every file is closed once written.
+func (o *Outputer) Close() error {
+	return nil
+}
+
+// Saved checks whether file of fileName is saved in output directory, like by previous runs.
+func (o *Outputer) Saved(fileName string, res *fetcher.FetchResult) bool {
+	saved := o.bodyFileName(fileName)
+	if o.ContentAddressed {
+		saved = suffixedFileName(fileName, digestSuffix)
+	}
+
+	_, err := os.Stat(path.Join(o.OutputDirectory, saved))
+
+	return err == nil
+}
+
+// Check whether res named fileName should be output, by pattern of file name and allowed media types.
+func accepted(pattern *regexp.Regexp, allowedMIME []string, fileName string, res *fetcher.FetchResult) bool {
+	if !pattern.MatchString(fileName) {
+		log.Logger.Info("OutputFile(): url: %s match failed", fileName)
+		return false
+	}
+
+	if !mimeAllowed(allowedMIME, res.ContentType) {
+		log.Logger.Info("OutputFile(): url: %s, media type: %s not allowed", fileName, res.ContentType)
+		return false
+	}
+
+	return true
+}
+
+// Check whether media type should be saved, all are saved if patterns is empty.
+func mimeAllowed(patterns []string, mediaType string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, mediaType); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Write content into file named fileName in output directory.
+func (o *Outputer) writeFile(fileName string, content []byte) error {
+	return writeFile(path.Join(o.OutputDirectory, fileName), content)
+}
 
-	f, err := os.Create(fp)
+// Write body compressed into file named fileName with suffix of codec in output directory.
+func (o *Outputer) writeBody(fileName string, body []byte) error {
+	content, err := o.compressor.compress(body)
 	if err != nil {
-		return fmt.Errorf("os.Create(): ap: %s, err: %v", fp, err)
+		return fmt.Errorf("file: %s, compress(): %v", fileName, err)
+	}
+
+	return o.writeFile(o.bodyFileName(fileName), content)
+}
+
+// Get name of file saving body named fileName, with suffix of codec kept if the name is hashed.
+func (o *Outputer) bodyFileName(fileName string) string {
+	return suffixedFileName(fileName, o.compressor.suffix)
+}
+
+// Save body as object named by its SHA-256 in objectsDirectory, like objects/ab/abcd..., unless saved already,
+// and record the SHA-256 in file named by fileName and digestSuffix.
+func (o *Outputer) writeObject(fileName string, body []byte) error {
+	sum := sha256.Sum256(body)
+	digest := hex.EncodeToString(sum[:])
+
+	fp := objectPath(o.OutputDirectory, digest) + o.compressor.suffix
+	_, err := os.Stat(fp)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("file: %s, os.Stat(): %v", fp, err)
+	}
+
+	if err == nil {
+		// same body of another URL
+		bodiesDeduplicated.Inc()
+	} else {
+		err = os.MkdirAll(filepath.Dir(fp), os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("directory: %s, os.MkdirAll(): %v", filepath.Dir(fp), err)
+		}
+
+		content, err := o.compressor.compress(body)
+		if err != nil {
+			return fmt.Errorf("file: %s, compress(): %v", fp, err)
+		}
+
+		err = writeFile(fp, content)
+		if err != nil {
+			return err
+		}
 	}
-	defer f.Close()
 
-	_, err = f.Write(content)
+	return o.writeFile(suffixedFileName(fileName, digestSuffix), []byte(digest))
+}
+
+// Get path of object whose SHA-256 in hex is digest, sharded by its first byte.
+func objectPath(directory, digest string) string {
+	return path.Join(directory, objectsDirectory, digest[:2], digest)
+}
+
+// Write content into file of path fp atomically. Content is written into a temp file in the same directory,
+// synced and renamed to fp, so that fp is never left truncated by crash.
+// Temp files left by crash are named with tempFilePrefix, and can be removed safely.
+func writeFile(fp string, content []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(fp), tempFilePrefix)
 	if err != nil {
+		return fmt.Errorf("ioutil.TempFile(): ap: %s, err: %v", fp, err)
+	}
+	tmp := f.Name()
+
+	err = writeAndSync(f, content)
+	if err != nil {
+		os.Remove(tmp)
 		return fmt.Errorf("write to file: %s failed, err: %v", fp, err)
 	}
 
-	log.Logger.Info("OutputFile(): url: %s output successfully", fileName)
+	err = os.Rename(tmp, fp)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("os.Rename(): ap: %s, err: %v", fp, err)
+	}
 
 	return nil
 }
 
+// Write content into f, sync and close it.
+func writeAndSync(f *os.File, content []byte) error {
+	_, err := f.Write(content)
+	if err == nil {
+		// temp files are created with 0600
+		err = f.Chmod(0644)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
 // For file names that longer than fileNameMaxLength,
 // do md5 hash for [(fileNameMaxLength - md5HashLength):] of the file name,
 // append hash result to [:(fileNameMaxLength - md5HashLength)] of the file name
-// as new file name.
+// as new file name, same as package reader.
 func hashLongFileName(fileName string) string {
-	if len(fileName) <= fileNameMaxLength {
-		return fileName
-	}
-
-	reserve := fileName[:(fileNameMaxLength - md5HashLength)]
-	needHash := fileName[(fileNameMaxLength - md5HashLength):]
-
-	md5Inst := md5.New()
-	md5Inst.Write([]byte(needHash))
-	hashed := hex.EncodeToString(md5Inst.Sum([]byte("")))
+	return reader.FileName(fileName, "")
+}
 
-	return reserve + hashed
+// Get name of file named fileName and suffix, fileName is hashed like hashLongFileName if too long,
+// with room left for suffix, so that suffix is kept.
+func suffixedFileName(fileName, suffix string) string {
+	return reader.FileName(fileName, suffix)
 }
@@ -3,6 +3,7 @@
 package outputer
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path"
@@ -12,6 +13,8 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+	"github.com/NKztq/spider/reader"
 )
 
 func TestOutputFile(t *testing.T) {
@@ -24,10 +27,10 @@ func TestOutputFile(t *testing.T) {
 	fileName := "test.html"
 	content := []byte("test")
 
-	o, err := NewOutputer(conf.OutputerConf{directory, ".*.(htm|html)$"})
+	o, err := NewOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*.(htm|html)$"})
 	assert.NoError(t, err)
 
-	err = o.OutputFile(fileName, content)
+	err = o.OutputFile(fileName, &fetcher.FetchResult{Body: content})
 	assert.NoError(t, err)
 
 	fp := path.Join(directory, fileName)
@@ -46,10 +49,10 @@ func TestOutputFile_LongFileName(t *testing.T) {
 	fileName := "testtesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttesttest.html"
 	content := []byte("test")
 
-	o, err := NewOutputer(conf.OutputerConf{directory, ".*.(htm|html)$"})
+	o, err := NewOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*.(htm|html)$"})
 	assert.NoError(t, err)
 
-	err = o.OutputFile(fileName, content)
+	err = o.OutputFile(fileName, &fetcher.FetchResult{Body: content})
 	assert.NoError(t, err)
 
 	fp := path.Join(directory, hashLongFileName(fileName))
@@ -68,13 +71,255 @@ func TestOutputFile_FileNameNotMatch(t *testing.T) {
 	fileName := "notMatchFileName"
 	content := []byte("test")
 
-	o, err := NewOutputer(conf.OutputerConf{directory, ".*.(htm|html)$"})
+	o, err := NewOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*.(htm|html)$"})
 	assert.NoError(t, err)
 
-	err = o.OutputFile(fileName, content)
+	err = o.OutputFile(fileName, &fetcher.FetchResult{Body: content})
 	assert.NoError(t, err)
 
 	fp := path.Join(directory, hashLongFileName(fileName))
 	_, err = ioutil.ReadFile(fp)
 	assert.True(t, strings.Contains(err.Error(), "no such file or directory"))
 }
+
+func TestOutputFile_Metadata(t *testing.T) {
+	directory := "./test_output2"
+	defer func() {
+		// remove UT output
+		assert.NoError(t, os.RemoveAll(directory))
+	}()
+
+	fileName := "test.html"
+	res := &fetcher.FetchResult{
+		URL:         "http://www.baidu.com/test.html",
+		FinalURL:    "http://www.baidu.com/test.html",
+		StatusCode:  200,
+		ContentType: "text/html",
+		ETag:        `"abc"`,
+		Body:        []byte("test"),
+	}
+
+	o, err := NewOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*.(htm|html)$", SaveMetadata: true})
+	assert.NoError(t, err)
+
+	err = o.OutputFile(fileName, res)
+	assert.NoError(t, err)
+
+	fData, err := ioutil.ReadFile(path.Join(directory, fileName))
+	assert.NoError(t, err)
+	assert.Equal(t, res.Body, fData)
+
+	mData, err := ioutil.ReadFile(path.Join(directory, fileName+metadataSuffix))
+	assert.NoError(t, err)
+
+	var m Metadata
+	assert.NoError(t, json.Unmarshal(mData, &m))
+	assert.Equal(t, res.URL, m.URL)
+	assert.Equal(t, 200, m.StatusCode)
+	assert.Equal(t, "text/html", m.ContentType)
+	assert.Equal(t, `"abc"`, m.ETag)
+	assert.Equal(t, 4, m.Length)
+}
+
+func TestOutputFile_LongFileNameSuffix(t *testing.T) {
+	directory, err := ioutil.TempDir("", "outputer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	fileName := strings.Repeat("test", 75) + ".html"
+	for _, contentAddressed := range []bool{false, true} {
+		o, err := NewOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*", SaveMetadata: true, ContentAddressed: contentAddressed})
+		assert.NoError(t, err)
+		assert.NoError(t, o.OutputFile(fileName, &fetcher.FetchResult{Body: []byte("test")}))
+
+		// read from body file, or from object once body file is removed
+		data, err := reader.ReadFile(path.Join(directory, fileName))
+		assert.NoError(t, err)
+		assert.Equal(t, "test", string(data))
+		if !contentAddressed {
+			assert.NoError(t, os.Remove(path.Join(directory, hashLongFileName(fileName))))
+		}
+	}
+
+	// suffixes are kept if names are hashed
+	infos, err := ioutil.ReadDir(directory)
+	assert.NoError(t, err)
+	names := []string{}
+	for _, info := range infos {
+		if !info.IsDir() {
+			assert.True(t, len(info.Name()) <= fileNameMaxLength, info.Name())
+			names = append(names, info.Name())
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		suffixedFileName(fileName, metadataSuffix),
+		suffixedFileName(fileName, digestSuffix),
+	}, names)
+	assert.True(t, strings.HasSuffix(suffixedFileName(fileName, metadataSuffix), metadataSuffix))
+	assert.True(t, strings.HasSuffix(suffixedFileName(fileName, digestSuffix), digestSuffix))
+}
+
+func TestOutputFile_AllowedMIME(t *testing.T) {
+	directory := "./test_output3"
+	defer func() {
+		// remove UT output
+		assert.NoError(t, os.RemoveAll(directory))
+	}()
+
+	o, err := NewOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*", AllowedMIME: []string{"text/html", "image/*"}})
+	assert.NoError(t, err)
+
+	for fileName, contentType := range map[string]string{"page": "text/html", "image": "image/png", "pdf": "application/pdf", "unknown": ""} {
+		err = o.OutputFile(fileName, &fetcher.FetchResult{ContentType: contentType, Body: []byte("test")})
+		assert.NoError(t, err)
+	}
+
+	files, err := ioutil.ReadDir(directory)
+	assert.NoError(t, err)
+
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	assert.Equal(t, []string{"image", "page"}, names)
+}
+
+func TestWriteFile(t *testing.T) {
+	directory, err := ioutil.TempDir("", "outputer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	fp := path.Join(directory, "test.html")
+	assert.NoError(t, writeFile(fp, []byte("old")))
+	// replaced atomically
+	assert.NoError(t, writeFile(fp, []byte("new")))
+
+	fData, err := ioutil.ReadFile(fp)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(fData))
+
+	info, err := os.Stat(fp)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// no temp file left
+	files, err := ioutil.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	// directory as target, temp file removed
+	assert.NoError(t, os.Mkdir(path.Join(directory, "dir"), os.ModePerm))
+	assert.Error(t, writeFile(path.Join(directory, "dir"), []byte("test")))
+	files, err = ioutil.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	assert.Error(t, writeFile(path.Join(directory, "notExist", "test.html"), []byte("test")))
+}
+
+func TestOutputFile_ContentAddressed(t *testing.T) {
+	directory, err := ioutil.TempDir("", "outputer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	o, err := NewOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*", ContentAddressed: true})
+	assert.NoError(t, err)
+
+	// mirrors of the same body
+	for _, fileName := range []string{"a.html", "b.html"} {
+		assert.NoError(t, o.OutputFile(fileName, &fetcher.FetchResult{Body: []byte("mirror")}))
+	}
+	assert.NoError(t, o.OutputFile("c.html", &fetcher.FetchResult{Body: []byte("other")}))
+
+	// sha256 of "mirror" and "other"
+	mirror := "00154761637ca746c354a6d9cfbf1da1a92e79afa6bb127bb8a1c434e9c73170"
+	other := "d9298a10d1b0735837dc4bd85dac641b0f3cef27a47e5d53a54f2f3f5b2fcffa"
+	for fileName, expect := range map[string]string{"a.html": mirror, "b.html": mirror, "c.html": other} {
+		digest, err := ioutil.ReadFile(path.Join(directory, fileName+digestSuffix))
+		assert.NoError(t, err)
+		assert.Equal(t, expect, string(digest), fileName)
+
+		_, err = os.Stat(path.Join(directory, fileName))
+		assert.True(t, os.IsNotExist(err), fileName)
+	}
+
+	body, err := ioutil.ReadFile(objectPath(directory, mirror))
+	assert.NoError(t, err)
+	assert.Equal(t, "mirror", string(body))
+	assert.Equal(t, path.Join(directory, "objects", "00", mirror), objectPath(directory, mirror))
+
+	// one object per body
+	shards, err := ioutil.ReadDir(path.Join(directory, objectsDirectory))
+	assert.NoError(t, err)
+	assert.Len(t, shards, 2)
+}
+
+func TestOutputFile_Compression(t *testing.T) {
+	directory, err := ioutil.TempDir("", "outputer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	body := []byte(strings.Repeat("<html>hello</html>", 100))
+
+	// one directory written by all codecs, read back whichever codec
+	for _, cfg := range []conf.OutputerConf{
+		{OutputDirectory: directory, TargetURL: ".*", Compression: "gzip"},
+		{OutputDirectory: directory, TargetURL: ".*", Compression: "zstd", CompressionLevel: 3},
+		{OutputDirectory: directory, TargetURL: ".*", Compression: "zstd", ContentAddressed: true},
+	} {
+		o, err := NewOutputer(cfg)
+		assert.NoError(t, err)
+
+		fileName := cfg.Compression + ".html"
+		if cfg.ContentAddressed {
+			fileName = "object.html"
+		}
+		assert.NoError(t, o.OutputFile(fileName, &fetcher.FetchResult{Body: body}))
+
+		data, err := reader.ReadFile(path.Join(directory, fileName))
+		assert.NoError(t, err)
+		assert.Equal(t, body, data, fileName)
+	}
+
+	// codec is recorded by suffix
+	fData, err := ioutil.ReadFile(path.Join(directory, "gzip.html.gz"))
+	assert.NoError(t, err)
+	assert.True(t, len(fData) < len(body)/5)
+	_, err = os.Stat(path.Join(directory, "zstd.html.zst"))
+	assert.NoError(t, err)
+	_, err = os.Stat(path.Join(directory, "gzip.html"))
+	assert.True(t, os.IsNotExist(err))
+
+	// suffix is kept if name is hashed
+	o, err := NewOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*", Compression: "zstd"})
+	assert.NoError(t, err)
+	fileName := strings.Repeat("test", 100) + ".html"
+	assert.NoError(t, o.OutputFile(fileName, &fetcher.FetchResult{Body: body}))
+	bodyFileName := o.bodyFileName(fileName)
+	assert.Len(t, bodyFileName, fileNameMaxLength)
+	assert.True(t, strings.HasSuffix(bodyFileName, ".zst"))
+	assert.True(t, o.Saved(fileName, nil))
+	data, err := reader.ReadFile(path.Join(directory, fileName))
+	assert.NoError(t, err)
+	assert.Equal(t, body, data)
+}
+
+func TestSaved(t *testing.T) {
+	directory, err := ioutil.TempDir("", "outputer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	for _, contentAddressed := range []bool{false, true} {
+		o, err := NewOutputer(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*", ContentAddressed: contentAddressed})
+		assert.NoError(t, err)
+
+		res := &fetcher.FetchResult{Body: []byte("test")}
+		assert.False(t, o.Saved("a.html", res))
+		assert.NoError(t, o.OutputFile("a.html", res))
+		assert.True(t, o.Saved("a.html", res))
+
+		// output directory wiped
+		assert.NoError(t, os.RemoveAll(directory))
+		assert.False(t, o.Saved("a.html", res))
+	}
+}
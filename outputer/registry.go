@@ -0,0 +1,88 @@
+// registry.go - registry of outputer backends, selected by type in config.
+
+package outputer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+)
+
+const (
+	defaultType = "filesystem" // type of backend if not configured
+)
+
+// Backend outputs fetched results, it implements crawler.Outputer.
+type Backend interface {
+	// Output fetched result, named fileName by crawler.
+	OutputFile(fileName string, res *fetcher.FetchResult) error
+
+	// Flush and release resources, called once crawling is finished.
+	Close() error
+}
+
+// Factory creates a backend by config, it reads [Outputer] and its own section.
+type Factory func(cfg conf.Config) (Backend, error)
+
+var (
+	factoriesLock sync.Mutex
+	factories     = make(map[string]Factory) // type => factory
+)
+
+func init() {
+	Register(defaultType, func(cfg conf.Config) (Backend, error) {
+		return NewOutputer(cfg.Outputer)
+	})
+}
+
+// Register registers factory of backend type, panics if type is registered already, like duplicate flags.
+func Register(backendType string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	if _, ok := factories[backendType]; ok {
+		panic(fmt.Sprintf("outputer: duplicate backend type: %s", backendType))
+	}
+
+	factories[backendType] = factory
+}
+
+// Types gets registered backend types, sorted.
+func Types() []string {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	types := make([]string, 0, len(factories))
+	for backendType := range factories {
+		types = append(types, backendType)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// New creates backend selected by cfg.Outputer.Type, "filesystem" if empty.
+func New(cfg conf.Config) (Backend, error) {
+	backendType := cfg.Outputer.Type
+	if backendType == "" {
+		backendType = defaultType
+	}
+
+	factoriesLock.Lock()
+	factory, ok := factories[backendType]
+	factoriesLock.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown outputer type: %s, should be one of %v", backendType, Types())
+	}
+
+	backend, err := factory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("type: %s: %v", backendType, err)
+	}
+
+	return backend, nil
+}
@@ -0,0 +1,72 @@
+// registry_test.go - UT for registry.go.
+
+package outputer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/conf"
+)
+
+func TestTypes(t *testing.T) {
+	// sqlite is registered only if built with tag sqlite
+	types := Types()
+	assert.True(t, sort.StringsAreSorted(types))
+	assert.Subset(t, types, []string{"filesystem", "hierarchical", "jsonl", "s3", "warc"})
+}
+
+func TestNew(t *testing.T) {
+	directory, err := ioutil.TempDir("", "registry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	cfg := conf.Config{
+		Outputer:      conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*"},
+		OutputerJSONL: conf.JSONLOutputerConf{File: path.Join(directory, "pages.jsonl")},
+		OutputerS3:    conf.S3OutputerConf{Endpoint: "http://127.0.0.1:9000", Bucket: "spider"},
+	}
+
+	// filesystem if empty
+	backend, err := New(cfg)
+	assert.NoError(t, err)
+	assert.IsType(t, &Outputer{}, backend)
+
+	expects := map[string]Backend{
+		"filesystem":   &Outputer{},
+		"hierarchical": &HierarchicalOutputer{},
+		"warc":         &WARCWriter{},
+		"jsonl":        &JSONLOutputer{},
+		"s3":           &S3Outputer{},
+	}
+	for backendType, expect := range expects {
+		cfg.Outputer.Type = backendType
+		backend, err := New(cfg)
+		assert.NoError(t, err, backendType)
+		assert.IsType(t, expect, backend)
+		assert.NoError(t, backend.Close(), backendType)
+	}
+}
+
+func TestNew_UnknownType(t *testing.T) {
+	_, err := New(conf.Config{Outputer: conf.OutputerConf{Type: "tar", TargetURL: ".*"}})
+	assert.EqualError(t, err, fmt.Sprintf("unknown outputer type: tar, should be one of %v", Types()))
+}
+
+func TestNew_FactoryError(t *testing.T) {
+	_, err := New(conf.Config{Outputer: conf.OutputerConf{Type: "hierarchical", TargetURL: "("}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "type: hierarchical: url: (, regexp.Compile()")
+}
+
+func TestRegister_Duplicate(t *testing.T) {
+	assert.Panics(t, func() {
+		Register("filesystem", nil)
+	})
+}
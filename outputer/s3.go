@@ -0,0 +1,250 @@
+// s3.go - output bodies as objects of an S3-compatible object store.
+
+package outputer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/baidu/go-lib/log"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+)
+
+const (
+	s3DefaultRegion = "us-east-1"
+	s3Service       = "s3"
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3DateFormat    = "20060102T150405Z"
+	s3Timeout       = 60 * time.Second
+)
+
+// S3Outputer puts body of every fetched result as object Prefix+fileName of Bucket,
+// by path-style URLs like Endpoint/Bucket/Key, so that local stand-ins like MinIO work as well.
+type S3Outputer struct {
+	Endpoint     string
+	Region       string
+	Bucket       string
+	Prefix       string
+	AccessKey    string
+	SecretKey    string
+	Pattern      *regexp.Regexp
+	SaveMetadata bool     // save metadata as object Key+metadataSuffix or not
+	AllowedMIME  []string // glob patterns of media types to save, all saved if empty
+
+	client *http.Client
+}
+
+func init() {
+	Register("s3", func(cfg conf.Config) (Backend, error) {
+		return NewS3Outputer(cfg.Outputer, cfg.OutputerS3)
+	})
+}
+
+func NewS3Outputer(cfg conf.OutputerConf, s3Cfg conf.S3OutputerConf) (*S3Outputer, error) {
+	pattern, err := regexp.Compile(cfg.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("url: %s, regexp.Compile(): %v", cfg.TargetURL, err)
+	}
+
+	region := s3Cfg.Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+
+	return &S3Outputer{
+		Endpoint:     strings.TrimSuffix(s3Cfg.Endpoint, "/"),
+		Region:       region,
+		Bucket:       s3Cfg.Bucket,
+		Prefix:       s3Cfg.Prefix,
+		AccessKey:    s3Cfg.AccessKey,
+		SecretKey:    s3Cfg.SecretKey,
+		Pattern:      pattern,
+		SaveMetadata: cfg.SaveMetadata,
+		AllowedMIME:  cfg.AllowedMIME,
+		client:       &http.Client{Timeout: s3Timeout},
+	}, nil
+}
+
+// Put body of res as object Prefix+fileName, and metadata of res as object Prefix+fileName+metadataSuffix
+// if SaveMetadata is set.
+func (o *S3Outputer) OutputFile(fileName string, res *fetcher.FetchResult) error {
+	if !accepted(o.Pattern, o.AllowedMIME, fileName, res) {
+		return nil
+	}
+
+	key := o.Prefix + fileName
+
+	contentType := res.ContentType
+	if res.Transcoded {
+		contentType += "; charset=utf-8"
+	}
+
+	err := o.putObject(key, contentType, res.FinalURL, res.Body)
+	if err != nil {
+		return err
+	}
+
+	filesWritten.Inc()
+
+	if o.SaveMetadata {
+		metadata, err := encodeMetadata(res)
+		if err != nil {
+			return fmt.Errorf("url: %s, encodeMetadata(): %v", fileName, err)
+		}
+
+		err = o.putObject(key+metadataSuffix, "application/json", res.FinalURL, metadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Logger.Info("OutputFile(): url: %s output successfully", fileName)
+
+	return nil
+}
+
+// Close does nothing, every object is put once output.
+func (o *S3Outputer) Close() error {
+	return nil
+}
+
+// Put content as object key.
+func (o *S3Outputer) putObject(key, contentType, sourceURL string, content []byte) error {
+	objectURL := o.Endpoint + "/" + s3EscapePath(o.Bucket+"/"+key)
+
+	req, err := http.NewRequest(http.MethodPut, objectURL, bytes.NewReader(content))
+	if err != nil {
+		return fmt.Errorf("url: %s, http.NewRequest(): %v", objectURL, err)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("x-amz-meta-url", sourceURL)
+
+	if o.AccessKey != "" {
+		s3Sign(req, content, o.AccessKey, o.SecretKey, o.Region, time.Now())
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("url: %s, client.Do(): %v", objectURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("url: %s, put object failed, status: %d, response: %s", objectURL, resp.StatusCode, message)
+	}
+
+	return nil
+}
+
+// Sign req by AWS signature V4, with payload as body of req.
+// Host and all headers of req are signed, x-amz-date and x-amz-content-sha256 are set.
+func s3Sign(req *http.Request, payload []byte, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format(s3DateFormat)
+	date := amzDate[:8]
+
+	payloadHash := sha256.Sum256(payload)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", hex.EncodeToString(payloadHash[:]))
+
+	// canonical headers, lower case names sorted
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalPath := req.URL.EscapedPath()
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, s3Service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, s3Service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, accessKey, scope, signedHeaders, signature))
+}
+
+// Get canonical query string of AWS signature V4, sorted by name then value.
+func s3CanonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(name, true)+"="+s3Escape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+// Escape object path as required by S3, every byte except unreserved ones and "/" is escaped.
+func s3EscapePath(p string) string {
+	return s3Escape(p, false)
+}
+
+// Escape s by URI encoding of AWS signature V4, "/" is escaped only if escapeSlash is set.
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !escapeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
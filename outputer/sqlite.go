@@ -0,0 +1,142 @@
+//go:build sqlite
+// +build sqlite
+
+// sqlite.go - output fetched results into a SQLite database.
+//
+// The driver github.com/mattn/go-sqlite3 needs cgo, so this backend is only built with tag sqlite:
+//   go build -tags sqlite
+
+package outputer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/baidu/go-lib/log"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+)
+
+const (
+	defaultSQLiteTable = "pages"
+)
+
+// SQLiteOutputer saves every fetched result as a row keyed by final URL, a later fetch replaces the row.
+type SQLiteOutputer struct {
+	Pattern     *regexp.Regexp
+	AllowedMIME []string // glob patterns of media types to save, all saved if empty
+
+	db     *sql.DB
+	insert *sql.Stmt
+	exists *sql.Stmt
+}
+
+func init() {
+	Register("sqlite", func(cfg conf.Config) (Backend, error) {
+		return NewSQLiteOutputer(cfg.Outputer, cfg.OutputerSQLite)
+	})
+}
+
+func NewSQLiteOutputer(cfg conf.OutputerConf, sqliteCfg conf.SQLiteOutputerConf) (*SQLiteOutputer, error) {
+	pattern, err := regexp.Compile(cfg.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("url: %s, regexp.Compile(): %v", cfg.TargetURL, err)
+	}
+
+	// table is validated by sqliteCfg.Check()
+	table := sqliteCfg.Table
+	if table == "" {
+		table = defaultSQLiteTable
+	}
+
+	err = os.MkdirAll(filepath.Dir(sqliteCfg.File), os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("directory: %s, os.MkdirAll(): %v", filepath.Dir(sqliteCfg.File), err)
+	}
+
+	db, err := sql.Open("sqlite3", sqliteCfg.File)
+	if err != nil {
+		return nil, fmt.Errorf("file: %s, sql.Open(): %v", sqliteCfg.File, err)
+	}
+	// SQLite allows one writer only
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		url          TEXT PRIMARY KEY,
+		status_code  INTEGER,
+		content_type TEXT,
+		fetched_at   TEXT,
+		metadata     TEXT,
+		body         BLOB
+	)`, table))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("file: %s, create table: %s, db.Exec(): %v", sqliteCfg.File, table, err)
+	}
+
+	insert, err := db.Prepare(fmt.Sprintf(`INSERT OR REPLACE INTO %s
+		(url, status_code, content_type, fetched_at, metadata, body) VALUES (?, ?, ?, ?, ?, ?)`, table))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("file: %s, db.Prepare(): %v", sqliteCfg.File, err)
+	}
+
+	exists, err := db.Prepare(fmt.Sprintf(`SELECT 1 FROM %s WHERE url = ?`, table))
+	if err != nil {
+		insert.Close()
+		db.Close()
+		return nil, fmt.Errorf("file: %s, db.Prepare(): %v", sqliteCfg.File, err)
+	}
+
+	return &SQLiteOutputer{Pattern: pattern, AllowedMIME: cfg.AllowedMIME, db: db, insert: insert, exists: exists}, nil
+}
+
+// Save res as a row, replacing row of the same URL.
+func (o *SQLiteOutputer) OutputFile(fileName string, res *fetcher.FetchResult) error {
+	if !accepted(o.Pattern, o.AllowedMIME, fileName, res) {
+		return nil
+	}
+
+	metadata, err := json.Marshal(newMetadata(res))
+	if err != nil {
+		return fmt.Errorf("url: %s, json.Marshal(): %v", res.FinalURL, err)
+	}
+
+	_, err = o.insert.Exec(res.FinalURL, res.StatusCode, res.ContentType,
+		res.FetchedAt.UTC().Format(time.RFC3339), string(metadata), res.Body)
+	if err != nil {
+		return fmt.Errorf("url: %s, insert.Exec(): %v", res.FinalURL, err)
+	}
+
+	filesWritten.Inc()
+
+	log.Logger.Info("OutputFile(): url: %s output successfully", fileName)
+
+	return nil
+}
+
+// Saved checks whether row of final URL of res exists.
+func (o *SQLiteOutputer) Saved(fileName string, res *fetcher.FetchResult) bool {
+	var one int
+	err := o.exists.QueryRow(res.FinalURL).Scan(&one)
+	if err != nil && err != sql.ErrNoRows {
+		log.Logger.Warn("Saved(): url: %s, exists.QueryRow(): %v", res.FinalURL, err)
+	}
+
+	return err == nil
+}
+
+// Close closes database.
+func (o *SQLiteOutputer) Close() error {
+	o.insert.Close()
+	o.exists.Close()
+
+	return o.db.Close()
+}
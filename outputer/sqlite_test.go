@@ -0,0 +1,91 @@
+//go:build sqlite
+// +build sqlite
+
+// sqlite_test.go - UT for sqlite.go.
+
+package outputer
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+)
+
+func TestSQLiteOutputer(t *testing.T) {
+	directory, err := ioutil.TempDir("", "sqlite")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	fp := path.Join(directory, "pages.db")
+	o, err := NewSQLiteOutputer(conf.OutputerConf{TargetURL: ".*"}, conf.SQLiteOutputerConf{File: fp, Table: "crawled"})
+	assert.NoError(t, err)
+
+	fetchedAt := time.Date(2020, 3, 2, 8, 0, 0, 0, time.UTC)
+	res := &fetcher.FetchResult{FinalURL: "http://www.baidu.com/a.html", StatusCode: 200, ContentType: "text/html", Body: []byte("old"), FetchedAt: fetchedAt}
+	assert.NoError(t, o.OutputFile("a.html", res))
+
+	// replaced by later fetch
+	res.Body = []byte("new")
+	assert.NoError(t, o.OutputFile("a.html", res))
+	assert.NoError(t, o.OutputFile("b.html", &fetcher.FetchResult{FinalURL: "http://www.baidu.com/b.html", StatusCode: 404}))
+	assert.NoError(t, o.Close())
+
+	db, err := sql.Open("sqlite3", fp)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	var count int
+	assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM crawled").Scan(&count))
+	assert.Equal(t, 2, count)
+
+	var statusCode int
+	var contentType, fetched, metadata string
+	var body []byte
+	err = db.QueryRow("SELECT status_code, content_type, fetched_at, metadata, body FROM crawled WHERE url = ?", res.FinalURL).
+		Scan(&statusCode, &contentType, &fetched, &metadata, &body)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "text/html", contentType)
+	assert.Equal(t, "2020-03-02T08:00:00Z", fetched)
+	assert.Contains(t, metadata, `"final_url":"http://www.baidu.com/a.html"`)
+	assert.Equal(t, "new", string(body))
+}
+
+func TestSQLiteOutputer_Saved(t *testing.T) {
+	directory, err := ioutil.TempDir("", "sqlite")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	o, err := NewSQLiteOutputer(conf.OutputerConf{TargetURL: ".*"}, conf.SQLiteOutputerConf{File: path.Join(directory, "pages.db")})
+	assert.NoError(t, err)
+	defer o.Close()
+
+	res := &fetcher.FetchResult{FinalURL: "http://www.baidu.com/a.html", StatusCode: 200, Body: []byte("test")}
+	assert.False(t, o.Saved("a.html", res))
+	assert.NoError(t, o.OutputFile("a.html", res))
+	assert.True(t, o.Saved("a.html", res))
+}
+
+func TestNew_SQLite(t *testing.T) {
+	directory, err := ioutil.TempDir("", "sqlite")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	cfg := conf.Config{
+		Outputer:       conf.OutputerConf{Type: "sqlite", TargetURL: ".*"},
+		OutputerSQLite: conf.SQLiteOutputerConf{File: path.Join(directory, "pages.db")},
+	}
+
+	backend, err := New(cfg)
+	assert.NoError(t, err)
+	assert.IsType(t, &SQLiteOutputer{}, backend)
+	assert.NoError(t, backend.Close())
+}
@@ -0,0 +1,316 @@
+// warc.go - output fetched results as WARC/1.1 records.
+
+package outputer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/baidu/go-lib/log"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+)
+
+const (
+	warcVersion        = "WARC/1.1"
+	warcDateFormat     = "2006-01-02T15:04:05Z"
+	warcFileDateFormat = "20060102150405"
+	warcSuffix         = ".warc.gz"
+
+	defaultWARCPrefix  = "spider"
+	defaultWARCMaxSize = 1 << 30 // 1GB
+)
+
+// WARCWriter outputs fetched results into gzipped WARC/1.1 files, a request and a response record per result.
+// Every record is a gzip member of its own, so that records can be read randomly.
+// A file is rotated once larger than MaxSize, and starts with a warcinfo record.
+type WARCWriter struct {
+	OutputDirectory string
+	Pattern         *regexp.Regexp
+	AllowedMIME     []string // glob patterns of media types to save, all saved if empty
+	Prefix          string   // prefix of file names
+	MaxSize         int64    // file is rotated once larger than it, in bytes
+
+	lock     sync.Mutex
+	file     *os.File // current WARC file, nil before the first record
+	size     int64    // size of current file
+	serial   int      // serial of current file
+	infoID   string   // record ID of warcinfo of current file
+	hostname string   // hostname of crawler, in file names and warcinfo
+}
+
+func init() {
+	Register("warc", func(cfg conf.Config) (Backend, error) {
+		return NewWARCWriter(cfg.Outputer, cfg.OutputerWARC)
+	})
+}
+
+func NewWARCWriter(cfg conf.OutputerConf, warcCfg conf.WARCOutputerConf) (*WARCWriter, error) {
+	pattern, err := regexp.Compile(cfg.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("url: %s, regexp.Compile(): %v", cfg.TargetURL, err)
+	}
+
+	prefix := warcCfg.Prefix
+	if prefix == "" {
+		prefix = defaultWARCPrefix
+	}
+
+	maxSize := warcCfg.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultWARCMaxSize
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return &WARCWriter{
+		OutputDirectory: cfg.OutputDirectory,
+		Pattern:         pattern,
+		AllowedMIME:     cfg.AllowedMIME,
+		Prefix:          prefix,
+		MaxSize:         maxSize,
+		hostname:        hostname,
+	}, nil
+}
+
+// Output res as a request record and a response record, fileName is checked by Pattern only.
+func (w *WARCWriter) OutputFile(fileName string, res *fetcher.FetchResult) error {
+	if !accepted(w.Pattern, w.AllowedMIME, fileName, res) {
+		return nil
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.file == nil || w.size >= w.MaxSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	responseID := newRecordID()
+	response := w.newRecord("response", responseID, res, httpResponse(res))
+	response.header = append(response.header, [2]string{"WARC-Payload-Digest", digest(res.Body)})
+
+	request := w.newRecord("request", newRecordID(), res, httpRequest(res))
+	request.header = append(request.header, [2]string{"WARC-Concurrent-To", responseID})
+
+	for _, r := range []*warcRecord{response, request} {
+		if err := w.writeRecord(r); err != nil {
+			return fmt.Errorf("url: %s, writeRecord(): %v", res.FinalURL, err)
+		}
+	}
+
+	filesWritten.Inc()
+
+	log.Logger.Info("OutputFile(): url: %s output successfully", fileName)
+
+	return nil
+}
+
+// Close closes current WARC file.
+func (w *WARCWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+
+	return err
+}
+
+// Close current file, and open a new one starting with a warcinfo record. Should be called with w.lock held.
+func (w *WARCWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			log.Logger.Warn("rotate(): file: %s, Close(): %v", w.file.Name(), err)
+		}
+		w.file = nil
+	}
+
+	if err := os.MkdirAll(w.OutputDirectory, os.ModePerm); err != nil {
+		return fmt.Errorf("directory: %s, os.MkdirAll(): %v", w.OutputDirectory, err)
+	}
+
+	// file names like Prefix-Timestamp-Serial-Hostname.warc.gz, recommended by WARC spec
+	w.serial++
+	name := fmt.Sprintf("%s-%s-%05d-%s%s", w.Prefix, time.Now().UTC().Format(warcFileDateFormat), w.serial, w.hostname, warcSuffix)
+	fp := path.Join(w.OutputDirectory, name)
+
+	file, err := os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile(): fp: %s, err: %v", fp, err)
+	}
+	w.file = file
+	w.size = 0
+
+	w.infoID = newRecordID()
+	info := &warcRecord{
+		header: [][2]string{
+			{"WARC-Type", "warcinfo"},
+			{"WARC-Record-ID", w.infoID},
+			{"WARC-Date", time.Now().UTC().Format(warcDateFormat)},
+			{"WARC-Filename", name},
+			{"Content-Type", "application/warc-fields"},
+		},
+		block: warcFields([][2]string{
+			{"software", "mini_spider"},
+			{"format", "WARC File Format 1.1"},
+			{"conformsTo", "http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/"},
+			{"hostname", w.hostname},
+		}),
+	}
+
+	return w.writeRecord(info)
+}
+
+// a WARC record
+type warcRecord struct {
+	header [][2]string // named fields except WARC version and Content-Length, in order
+	block  []byte
+}
+
+// Create a record of res, referring to warcinfo of current file. Should be called with w.lock held.
+func (w *WARCWriter) newRecord(recordType, id string, res *fetcher.FetchResult, block []byte) *warcRecord {
+	fetchedAt := res.FetchedAt
+	if fetchedAt.IsZero() {
+		fetchedAt = time.Now()
+	}
+
+	return &warcRecord{
+		header: [][2]string{
+			{"WARC-Type", recordType},
+			{"WARC-Record-ID", id},
+			{"WARC-Date", fetchedAt.UTC().Format(warcDateFormat)},
+			{"WARC-Target-URI", res.FinalURL},
+			{"WARC-Warcinfo-ID", w.infoID},
+			{"WARC-Block-Digest", digest(block)},
+			{"Content-Type", "application/http;msgtype=" + recordType},
+		},
+		block: block,
+	}
+}
+
+// Write r as a gzip member into current file. Should be called with w.lock held.
+func (w *WARCWriter) writeRecord(r *warcRecord) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+
+	fmt.Fprintf(gz, "%s\r\n", warcVersion)
+	for _, field := range r.header {
+		fmt.Fprintf(gz, "%s: %s\r\n", field[0], field[1])
+	}
+	fmt.Fprintf(gz, "Content-Length: %d\r\n\r\n", len(r.block))
+	gz.Write(r.block)
+	io.WriteString(gz, "\r\n\r\n")
+
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("gzip.Close(): %v", err)
+	}
+
+	n, err := w.file.Write(buf.Bytes())
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write to file: %s failed, err: %v", w.file.Name(), err)
+	}
+
+	return nil
+}
+
+// Rebuild HTTP request of res, only GET is sent by fetcher.
+func httpRequest(res *fetcher.FetchResult) []byte {
+	var buf bytes.Buffer
+
+	requestURI := res.FinalURL
+	host := ""
+	if u, err := url.Parse(res.FinalURL); err == nil {
+		requestURI = u.RequestURI()
+		host = u.Host
+	}
+
+	fmt.Fprintf(&buf, "GET %s HTTP/1.1\r\n", requestURI)
+	fmt.Fprintf(&buf, "Host: %s\r\n", host)
+	res.RequestHeader.Write(&buf)
+	io.WriteString(&buf, "\r\n")
+
+	return buf.Bytes()
+}
+
+// Rebuild HTTP response of res. Body is decoded already,
+// so Content-Encoding is dropped and Content-Length is set to length of body.
+func httpResponse(res *fetcher.FetchResult) []byte {
+	var buf bytes.Buffer
+
+	proto := res.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	fmt.Fprintf(&buf, "%s %d %s\r\n", proto, res.StatusCode, http.StatusText(res.StatusCode))
+
+	header := http.Header{}
+	for key, values := range res.Header {
+		header[key] = values
+	}
+	header.Del("Content-Encoding")
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.Itoa(len(res.Body)))
+	if res.Transcoded {
+		header.Set("Content-Type", res.ContentType+"; charset=utf-8")
+	}
+	header.Write(&buf)
+
+	io.WriteString(&buf, "\r\n")
+	buf.Write(res.Body)
+
+	return buf.Bytes()
+}
+
+// Encode fields as application/warc-fields.
+func warcFields(fields [][2]string) []byte {
+	var buf bytes.Buffer
+	for _, field := range fields {
+		fmt.Fprintf(&buf, "%s: %s\r\n", field[0], field[1])
+	}
+
+	return buf.Bytes()
+}
+
+// Get labelled SHA-1 digest of data, like "sha1:BASE32".
+func digest(data []byte) string {
+	sum := sha1.Sum(data)
+
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// Get a new record ID, a random UUID as URN.
+func newRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+
+	// version 4, variant 10
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
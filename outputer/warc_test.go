@@ -0,0 +1,188 @@
+// warc_test.go - UT for warc.go.
+
+package outputer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+)
+
+// a record read back
+type readRecord struct {
+	header textproto.MIMEHeader
+	block  []byte
+}
+
+// Read all records of a gzipped WARC file.
+func readWARC(t *testing.T, fp string) []readRecord {
+	f, err := os.Open(fp)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	reader := bufio.NewReader(gz)
+
+	var records []readRecord
+	for {
+		version, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return records
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, "WARC/1.1\r\n", version)
+
+		header, err := textproto.NewReader(reader).ReadMIMEHeader()
+		assert.NoError(t, err)
+
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		assert.NoError(t, err)
+		block := make([]byte, length)
+		_, err = io.ReadFull(reader, block)
+		assert.NoError(t, err)
+
+		end := make([]byte, 4)
+		_, err = io.ReadFull(reader, end)
+		assert.NoError(t, err)
+		assert.Equal(t, "\r\n\r\n", string(end))
+
+		records = append(records, readRecord{header, block})
+	}
+}
+
+func newWARCTestResult(url string, body string) *fetcher.FetchResult {
+	return &fetcher.FetchResult{
+		URL:           url,
+		FinalURL:      url,
+		StatusCode:    200,
+		Proto:         "HTTP/1.1",
+		Header:        http.Header{"Content-Type": {"text/html; charset=gbk"}, "Content-Encoding": {"gzip"}},
+		Body:          []byte(body),
+		RequestHeader: http.Header{"User-Agent": {"mini_spider"}},
+		ContentType:   "text/html",
+		Charset:       "gbk",
+		Transcoded:    true,
+		FetchedAt:     time.Date(2020, 3, 2, 8, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWARCWriter(t *testing.T) {
+	directory, err := ioutil.TempDir("", "warc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	w, err := NewWARCWriter(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*", Type: "warc"}, conf.WARCOutputerConf{})
+	assert.NoError(t, err)
+
+	res := newWARCTestResult("http://www.baidu.com/a/b.html?q=1", "<html>hello</html>")
+	assert.NoError(t, w.OutputFile("http%3A%2F%2Fwww.baidu.com%2Fa%2Fb.html", res))
+	assert.NoError(t, w.Close())
+
+	files, err := ioutil.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.True(t, strings.HasPrefix(files[0].Name(), "spider-"))
+	assert.True(t, strings.HasSuffix(files[0].Name(), "-00001-"+w.hostname+".warc.gz"))
+
+	records := readWARC(t, path.Join(directory, files[0].Name()))
+	assert.Len(t, records, 3)
+
+	// warcinfo first
+	info := records[0]
+	assert.Equal(t, "warcinfo", info.header.Get("WARC-Type"))
+	assert.Equal(t, files[0].Name(), info.header.Get("WARC-Filename"))
+	assert.Equal(t, "application/warc-fields", info.header.Get("Content-Type"))
+	assert.Contains(t, string(info.block), "format: WARC File Format 1.1\r\n")
+
+	response := records[1]
+	assert.Equal(t, "response", response.header.Get("WARC-Type"))
+	assert.Equal(t, "http://www.baidu.com/a/b.html?q=1", response.header.Get("WARC-Target-URI"))
+	assert.Equal(t, "2020-03-02T08:00:00Z", response.header.Get("WARC-Date"))
+	assert.Equal(t, info.header.Get("WARC-Record-ID"), response.header.Get("WARC-Warcinfo-ID"))
+	assert.Equal(t, "application/http;msgtype=response", response.header.Get("Content-Type"))
+	assert.Equal(t, digest(response.block), response.header.Get("WARC-Block-Digest"))
+	assert.Equal(t, digest(res.Body), response.header.Get("WARC-Payload-Digest"))
+	assert.Regexp(t, `^<urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}>$`, response.header.Get("WARC-Record-ID"))
+
+	// HTTP response is readable, with decoded body
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(string(response.block))), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, res.Body, body)
+
+	request := records[2]
+	assert.Equal(t, "request", request.header.Get("WARC-Type"))
+	assert.Equal(t, response.header.Get("WARC-Record-ID"), request.header.Get("WARC-Concurrent-To"))
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(string(request.block))))
+	assert.NoError(t, err)
+	assert.Equal(t, "GET", req.Method)
+	assert.Equal(t, "/a/b.html?q=1", req.RequestURI)
+	assert.Equal(t, "www.baidu.com", req.Host)
+	assert.Equal(t, "mini_spider", req.Header.Get("User-Agent"))
+}
+
+func TestWARCWriter_Rotate(t *testing.T) {
+	directory, err := ioutil.TempDir("", "warc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	w, err := NewWARCWriter(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*"}, conf.WARCOutputerConf{Prefix: "test", MaxSize: 1})
+	assert.NoError(t, err)
+
+	for _, u := range []string{"http://www.baidu.com/1", "http://www.baidu.com/2", "http://www.baidu.com/3"} {
+		assert.NoError(t, w.OutputFile(u, newWARCTestResult(u, "hello")))
+	}
+	assert.NoError(t, w.Close())
+
+	// one file per result, each starts with warcinfo
+	files, err := ioutil.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+	for i, file := range files {
+		assert.True(t, strings.HasPrefix(file.Name(), "test-"))
+		assert.Contains(t, file.Name(), "-0000"+strconv.Itoa(i+1)+"-")
+
+		records := readWARC(t, path.Join(directory, file.Name()))
+		assert.Len(t, records, 3)
+		assert.Equal(t, "warcinfo", records[0].header.Get("WARC-Type"))
+		assert.Equal(t, records[0].header.Get("WARC-Record-ID"), records[1].header.Get("WARC-Warcinfo-ID"))
+	}
+}
+
+func TestWARCWriter_Filter(t *testing.T) {
+	directory, err := ioutil.TempDir("", "warc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	w, err := NewWARCWriter(conf.OutputerConf{OutputDirectory: directory, TargetURL: ".*.(htm|html)$", AllowedMIME: []string{"text/*"}}, conf.WARCOutputerConf{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.OutputFile("test.jpg", newWARCTestResult("http://www.baidu.com/test.jpg", "hello")))
+	res := newWARCTestResult("http://www.baidu.com/test.html", "hello")
+	res.ContentType = "image/png"
+	assert.NoError(t, w.OutputFile("test.html", res))
+	assert.NoError(t, w.Close())
+
+	files, err := ioutil.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,84 @@
+// directive.go - robots directives in html, like rel="nofollow" and <meta name="robots">.
+
+package parser
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Directives are page-level robots directives.
+type Directives struct {
+	NoIndex  bool // page should not be saved
+	NoFollow bool // links in page should not be followed
+}
+
+// MetaRobots gets directives from <meta name="robots" content="..."> of a html page.
+// Multiple robots meta elements are merged.
+func MetaRobots(n *html.Node) Directives {
+	var d Directives
+	metaRobots(n, &d)
+
+	return d
+}
+
+// Find robots meta elements recursively.
+func metaRobots(n *html.Node, d *Directives) {
+	if n.Type == html.ElementNode && n.Data == "meta" {
+		name, _ := getAttr(n, "name")
+		if strings.EqualFold(name, "robots") {
+			content, _ := getAttr(n, "content")
+			for _, token := range strings.Split(content, ",") {
+				switch strings.ToLower(strings.TrimSpace(token)) {
+				case "noindex":
+					d.NoIndex = true
+				case "nofollow":
+					d.NoFollow = true
+				case "none":
+					d.NoIndex = true
+					d.NoFollow = true
+				}
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		metaRobots(c, d)
+	}
+}
+
+// WithoutNofollow gets extractors which skip elements with rel="nofollow".
+func (e Extractors) WithoutNofollow() Extractors {
+	extractors := make(Extractors)
+	for element, list := range e {
+		for _, extract := range list {
+			extractors[element] = append(extractors[element], skipNofollow(extract))
+		}
+	}
+
+	return extractors
+}
+
+// Wrap extract to skip elements with rel="nofollow".
+func skipNofollow(extract Extractor) Extractor {
+	return func(n *html.Node) []string {
+		if isNofollow(n) {
+			return nil
+		}
+
+		return extract(n)
+	}
+}
+
+// Check whether rel of element contains "nofollow".
+func isNofollow(n *html.Node) bool {
+	rel, _ := getAttr(n, "rel")
+	for _, token := range strings.Fields(rel) {
+		if strings.EqualFold(token, "nofollow") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,57 @@
+// directive_test.go - UT for directive.go.
+
+package parser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+)
+
+func parseFile(t *testing.T, filePath string) *html.Node {
+	page, err := ioutil.ReadFile(filePath)
+	assert.NoError(t, err)
+
+	node, err := html.Parse(bytes.NewReader(page))
+	assert.NoError(t, err)
+
+	return node
+}
+
+func TestMetaRobots(t *testing.T) {
+	assert.Equal(t, Directives{NoIndex: true, NoFollow: true}, MetaRobots(parseFile(t, "./testdata/mock3.html")))
+	assert.Equal(t, Directives{NoIndex: true, NoFollow: true}, MetaRobots(parseFile(t, "./testdata/mock4.html")))
+
+	// no robots meta
+	assert.Equal(t, Directives{}, MetaRobots(parseFile(t, "./testdata/mock.html")))
+}
+
+func TestWithoutNofollow(t *testing.T) {
+	node := parseFile(t, "./testdata/mock3.html")
+
+	u, err := url.Parse("http://www.baidu.com/test/test")
+	assert.NoError(t, err)
+
+	extractors, err := NewExtractors([]string{"a.href", "area.href"})
+	assert.NoError(t, err)
+
+	// all links
+	deeperURLs := []*url.URL{}
+	Parse(node, u, extractors, &deeperURLs)
+	assert.Len(t, deeperURLs, 5)
+
+	// nofollow links skipped
+	deeperURLs = []*url.URL{}
+	Parse(node, u, extractors.WithoutNofollow(), &deeperURLs)
+
+	actualURLs := []string{}
+	for _, u := range deeperURLs {
+		actualURLs = append(actualURLs, u.String())
+	}
+
+	assert.Equal(t, []string{"http://www.baidu.com/test/follow.html", "http://www.baidu.com/test/external.html"}, actualURLs)
+}
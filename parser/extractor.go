@@ -0,0 +1,137 @@
+// extractor.go - extract links from elements.
+
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Extractor extracts raw links from an element node.
+type Extractor func(n *html.Node) []string
+
+// Extractors is a set of extractors, keyed by element.
+type Extractors map[string][]Extractor
+
+var (
+	// DefaultExtractors are used if no extractor is configured.
+	DefaultExtractors = []string{"a.href"}
+
+	registry = map[string]Extractor{} // "element.attribute" => extractor
+)
+
+func init() {
+	Register("a", "href", attrExtractor("href"))
+	Register("area", "href", attrExtractor("href"))
+	Register("link", "href", attrExtractor("href"))
+	Register("iframe", "src", attrExtractor("src"))
+	Register("frame", "src", attrExtractor("src"))
+	Register("form", "action", attrExtractor("action"))
+	Register("img", "srcset", srcsetExtractor)
+	Register("source", "srcset", srcsetExtractor)
+	Register("meta", "refresh", refreshExtractor)
+}
+
+// Register registers extractor for attribute of element,
+// it can be turned on by "element.attribute" afterwards.
+// Registering the same element and attribute twice overrides the former.
+func Register(element, attribute string, e Extractor) {
+	registry[element+"."+attribute] = e
+}
+
+// NewExtractors gets extractors by names like "a.href".
+// DefaultExtractors are used if names is empty.
+func NewExtractors(names []string) (Extractors, error) {
+	if len(names) == 0 {
+		names = DefaultExtractors
+	}
+
+	extractors := make(Extractors)
+	for _, name := range names {
+		e, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown extractor: %s", name)
+		}
+
+		element := name[:strings.Index(name, ".")]
+		extractors[element] = append(extractors[element], e)
+	}
+
+	return extractors, nil
+}
+
+// Get attribute of node, returns false if not exist.
+func getAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+
+	return "", false
+}
+
+// Get an extractor for links in attribute key.
+func attrExtractor(key string) Extractor {
+	return func(n *html.Node) []string {
+		if val, ok := getAttr(n, key); ok {
+			return []string{val}
+		}
+
+		return nil
+	}
+}
+
+// Extract links from srcset, like "a.png 1x, b.png 2x".
+func srcsetExtractor(n *html.Node) []string {
+	val, ok := getAttr(n, "srcset")
+	if !ok {
+		return nil
+	}
+
+	links := []string{}
+	for _, candidate := range strings.Split(val, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 {
+			links = append(links, fields[0])
+		}
+	}
+
+	return links
+}
+
+// Extract link from meta refresh, like <meta http-equiv="refresh" content="5; url=/path">.
+func refreshExtractor(n *html.Node) []string {
+	httpEquiv, _ := getAttr(n, "http-equiv")
+	if !strings.EqualFold(httpEquiv, "refresh") {
+		return nil
+	}
+
+	content, _ := getAttr(n, "content")
+
+	i := strings.Index(content, ";")
+	if i < 0 {
+		i = strings.Index(content, ",")
+	}
+	if i < 0 {
+		return nil
+	}
+
+	target := strings.TrimSpace(content[i+1:])
+	// drop "url=" prefix
+	if len(target) >= 3 && strings.EqualFold(target[:3], "url") {
+		rest := strings.TrimSpace(target[3:])
+		if strings.HasPrefix(rest, "=") {
+			target = strings.TrimSpace(rest[1:])
+		}
+	}
+
+	target = strings.Trim(target, `'"`)
+	if target == "" {
+		return nil
+	}
+
+	return []string{target}
+}
@@ -9,30 +9,59 @@ import (
 )
 
 // Parse a html page, find deeper URLs recursively.
+// Relative URLs are resolved against <base href> if the page has one.
 //
 // Params:
 //	- n: html node.
 //	- u: base URL for relative URLs in this node.
+//	- extractors: extractors for elements.
 //	- deeperURLs: output param, used for saving deeper URLs.
-func Parse(n *html.Node, u *url.URL, deeperURLs *[]*url.URL) {
-	if n.Type == html.ElementNode && n.Data == "a" {
-		for _, a := range n.Attr {
-			if a.Key != "href" {
-				continue
-			}
+func Parse(n *html.Node, u *url.URL, extractors Extractors, deeperURLs *[]*url.URL) {
+	if base := findBase(n); base != nil {
+		u = u.ResolveReference(base)
+	}
 
-			// parse URL and filter out invalid URL
-			rawURL, err := url.Parse(a.Val)
-			if err != nil {
-				continue
-			}
+	parse(n, u, extractors, deeperURLs)
+}
 
-			*(deeperURLs) = append(*(deeperURLs), u.ResolveReference(rawURL))
+// Find deeper URLs recursively.
+func parse(n *html.Node, u *url.URL, extractors Extractors, deeperURLs *[]*url.URL) {
+	if n.Type == html.ElementNode {
+		for _, extract := range extractors[n.Data] {
+			for _, link := range extract(n) {
+				// parse URL and filter out invalid URL
+				rawURL, err := url.Parse(link)
+				if err != nil {
+					continue
+				}
+
+				*(deeperURLs) = append(*(deeperURLs), u.ResolveReference(rawURL))
+			}
 		}
 	}
 
 	// tail recursion
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		Parse(c, u, deeperURLs)
+		parse(c, u, extractors, deeperURLs)
+	}
+}
+
+// Find href of the first <base> element, nil if not exist or invalid.
+func findBase(n *html.Node) *url.URL {
+	if n.Type == html.ElementNode && n.Data == "base" {
+		if href, ok := getAttr(n, "href"); ok {
+			base, err := url.Parse(href)
+			if err == nil {
+				return base
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if base := findBase(c); base != nil {
+			return base
+		}
 	}
+
+	return nil
 }
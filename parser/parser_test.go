@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -23,8 +24,11 @@ func TestParse(t *testing.T) {
 	req, err := http.NewRequest("GET", "http://www.baidu.com/test/test/test", nil)
 	assert.NoError(t, err)
 
+	extractors, err := NewExtractors(nil)
+	assert.NoError(t, err)
+
 	deeperURLs := []*url.URL{}
-	Parse(node, req.URL, &deeperURLs)
+	Parse(node, req.URL, extractors, &deeperURLs)
 
 	// deeper URLs ordered like:
 	//
@@ -51,3 +55,115 @@ func TestParse(t *testing.T) {
 
 	assert.Equal(t, expectedURLs, actualURLs)
 }
+
+func TestParse_AllExtractors(t *testing.T) {
+	page, err := ioutil.ReadFile("./testdata/mock1.html")
+	assert.NoError(t, err)
+
+	node, err := html.Parse(bytes.NewReader(page))
+	assert.NoError(t, err)
+
+	u, err := url.Parse("http://www.baidu.com/test/test")
+	assert.NoError(t, err)
+
+	extractors, err := NewExtractors([]string{"a.href", "area.href", "link.href", "iframe.src", "frame.src", "form.action", "img.srcset", "source.srcset", "meta.refresh"})
+	assert.NoError(t, err)
+
+	deeperURLs := []*url.URL{}
+	Parse(node, u, extractors, &deeperURLs)
+
+	// relative URLs are resolved against <base href>,
+	// <frame> is dropped by html.Parse since <body> exists
+	expectedURLs := []string{
+		"http://www.baidu.com/base/refresh.html",
+		"http://www.baidu.com/base/style.css",
+		"http://www.baidu.com/base/a.html",
+		"http://www.baidu.com/base/area.html",
+		"http://www.baidu.com/base/iframe.html",
+		"http://www.baidu.com/search",
+		"http://www.baidu.com/base/img-1x.png",
+		"http://img.o.s.t/img-2x.png",
+		"http://www.baidu.com/base/small.png",
+		"http://www.baidu.com/base/large.png",
+	}
+
+	actualURLs := []string{}
+	for _, u := range deeperURLs {
+		actualURLs = append(actualURLs, u.String())
+	}
+
+	assert.Equal(t, expectedURLs, actualURLs)
+}
+
+func TestParse_SomeExtractors(t *testing.T) {
+	page, err := ioutil.ReadFile("./testdata/mock1.html")
+	assert.NoError(t, err)
+
+	node, err := html.Parse(bytes.NewReader(page))
+	assert.NoError(t, err)
+
+	u, err := url.Parse("http://www.baidu.com/test/test")
+	assert.NoError(t, err)
+
+	extractors, err := NewExtractors([]string{"iframe.src", "form.action"})
+	assert.NoError(t, err)
+
+	deeperURLs := []*url.URL{}
+	Parse(node, u, extractors, &deeperURLs)
+
+	actualURLs := []string{}
+	for _, u := range deeperURLs {
+		actualURLs = append(actualURLs, u.String())
+	}
+
+	assert.Equal(t, []string{"http://www.baidu.com/base/iframe.html", "http://www.baidu.com/search"}, actualURLs)
+}
+
+func TestNewExtractors_Unknown(t *testing.T) {
+	_, err := NewExtractors([]string{"a.href", "a.src"})
+	assert.True(t, strings.Contains(err.Error(), "unknown extractor: a.src"))
+}
+
+func TestRefreshExtractor(t *testing.T) {
+	cases := map[string][]string{
+		"5; url=/a.html":    {"/a.html"},
+		"0;URL = '/a.html'": {"/a.html"},
+		"0, /a.html":        {"/a.html"},
+		"0; urlpath.html":   {"urlpath.html"},
+		"5":                 nil,
+		"5; url=":           nil,
+	}
+
+	for content, expect := range cases {
+		n := &html.Node{
+			Type: html.ElementNode,
+			Data: "meta",
+			Attr: []html.Attribute{{Key: "http-equiv", Val: "Refresh"}, {Key: "content", Val: content}},
+		}
+		assert.Equal(t, expect, refreshExtractor(n), content)
+	}
+}
+
+func TestParse_Frameset(t *testing.T) {
+	page, err := ioutil.ReadFile("./testdata/mock2.html")
+	assert.NoError(t, err)
+
+	node, err := html.Parse(bytes.NewReader(page))
+	assert.NoError(t, err)
+
+	u, err := url.Parse("http://www.baidu.com/test/test")
+	assert.NoError(t, err)
+
+	extractors, err := NewExtractors([]string{"frame.src"})
+	assert.NoError(t, err)
+
+	deeperURLs := []*url.URL{}
+	Parse(node, u, extractors, &deeperURLs)
+
+	actualURLs := []string{}
+	for _, u := range deeperURLs {
+		actualURLs = append(actualURLs, u.String())
+	}
+
+	assert.Equal(t, []string{"http://www.baidu.com/test/left.html", "http://www.baidu.com/test/right.html"}, actualURLs)
+}
@@ -0,0 +1,162 @@
+// reader.go - read pages saved by outputer, whichever codec wrote them.
+
+package reader
+
+import (
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// layout of content-addressed store of outputer
+	digestSuffix     = ".sha256"
+	objectsDirectory = "objects"
+	digestLength     = 64 // SHA-256 in hex
+
+	fileNameMaxLength = 255 // in Bytes, Linux&MacOS's max file name length
+	md5HashLength     = 32
+)
+
+// suffixes of files saved by outputer compressed by codecs
+var suffixes = map[string]string{
+	"":     "",
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+// codecs in order files are probed, not compressed first
+var codecs = []string{"", "gzip", "zstd"}
+
+// NewReader decompresses r by codec, "gzip" or "zstd", r is read as-is if codec is empty.
+// Codec is given rather than detected, so that bodies which are gzip or zstd streams themselves,
+// saved without compression, are read as-is.
+// Closing the returned reader releases decoder, and does not close r.
+func NewReader(r io.Reader, codec string) (io.ReadCloser, error) {
+	switch codec {
+	case "":
+		return ioutil.NopCloser(r), nil
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("gzip.NewReader(): %v", err)
+		}
+		return gz, nil
+	case "zstd":
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("zstd.NewReader(): %v", err)
+		}
+		return decoder.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf("invalid codec: %s", codec)
+}
+
+// Suffix gets suffix of files saved by outputer compressed by codec, like ".gz" of "gzip", empty if not compressed.
+func Suffix(codec string) string {
+	return suffixes[codec]
+}
+
+// a decompressed file, closing both decoder and file
+type fileReader struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (r *fileReader) Close() error {
+	r.ReadCloser.Close()
+
+	return r.file.Close()
+}
+
+// Open opens page saved by outputer as file of path fp, like "output/http%3A%2F%2Fwww.baidu.com",
+// decompressed by codec recorded in suffix of the file, which is probed as fp, fp+".gz" and fp+".zst".
+// Names too long are mapped as outputer does, see FileName.
+// If the body is saved in content-addressed store, it is found by SHA-256 recorded in file of path fp+".sha256".
+func Open(fp string) (io.ReadCloser, error) {
+	file, codec, err := openProbed(filepath.Dir(fp), filepath.Base(fp))
+	if os.IsNotExist(err) {
+		file, codec, err = openObject(fp)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewReader(file, codec)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("file: %s, NewReader(): %v", file.Name(), err)
+	}
+
+	return &fileReader{r, file}, nil
+}
+
+// ReadFile reads page saved by outputer as file of path fp, see Open.
+func ReadFile(fp string) ([]byte, error) {
+	r, err := Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// FileName gets name of file saving fileName with suffix by outputer, like suffix of codec or ".sha256".
+// fileName longer than max file name length is cut, and its tail is replaced by MD5 of the tail,
+// so that suffix is kept.
+func FileName(fileName, suffix string) string {
+	maxLength := fileNameMaxLength - len(suffix)
+	if len(fileName) <= maxLength {
+		return fileName + suffix
+	}
+
+	reserve := fileName[:(maxLength - md5HashLength)]
+	needHash := fileName[(maxLength - md5HashLength):]
+
+	sum := md5.Sum([]byte(needHash))
+
+	return reserve + hex.EncodeToString(sum[:]) + suffix
+}
+
+// Open file saving fileName in directory with suffix of any codec, and get the codec.
+func openProbed(directory, fileName string) (*os.File, string, error) {
+	for _, codec := range codecs {
+		file, err := os.Open(filepath.Join(directory, FileName(fileName, suffixes[codec])))
+		if !os.IsNotExist(err) {
+			return file, codec, err
+		}
+	}
+
+	return nil, "", &os.PathError{Op: "open", Path: filepath.Join(directory, fileName), Err: os.ErrNotExist}
+}
+
+// Open object of content-addressed store, whose SHA-256 is recorded in file of path fp+".sha256", and get its codec.
+// Objects are in objectsDirectory of the same directory, sharded by first byte of SHA-256, named with suffix of codec.
+func openObject(fp string) (*os.File, string, error) {
+	directory := filepath.Dir(fp)
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, FileName(filepath.Base(fp), digestSuffix)))
+	if os.IsNotExist(err) {
+		return nil, "", &os.PathError{Op: "open", Path: fp, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	digest := strings.TrimSpace(string(data))
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != digestLength {
+		return nil, "", fmt.Errorf("file: %s, invalid SHA-256: %s", fp+digestSuffix, digest)
+	}
+
+	return openProbed(filepath.Join(directory, objectsDirectory, digest[:2]), digest)
+}
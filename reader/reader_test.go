@@ -0,0 +1,151 @@
+// reader_test.go - UT for reader.go.
+
+package reader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+
+	return buf.Bytes()
+}
+
+func zstded(t *testing.T, data []byte) []byte {
+	encoder, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+
+	return encoder.EncodeAll(data, nil)
+}
+
+func TestNewReader(t *testing.T) {
+	body := []byte("<html>hello</html>")
+
+	for codec, content := range map[string][]byte{
+		"":     body,
+		"gzip": gzipped(t, body),
+		"zstd": zstded(t, body),
+	} {
+		r, err := NewReader(bytes.NewReader(content), codec)
+		assert.NoError(t, err, codec)
+
+		data, err := ioutil.ReadAll(r)
+		assert.NoError(t, err, codec)
+		assert.NoError(t, r.Close())
+		assert.Equal(t, body, data, codec)
+	}
+
+	// gzip body saved without compression is read as-is
+	r, err := NewReader(bytes.NewReader(gzipped(t, body)), "")
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, gzipped(t, body), data)
+
+	// empty
+	r, err = NewReader(bytes.NewReader(nil), "")
+	assert.NoError(t, err)
+	data, err = ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+
+	// broken gzip header
+	_, err = NewReader(bytes.NewReader([]byte{0x1f, 0x8b, 0x08}), "gzip")
+	assert.Error(t, err)
+
+	_, err = NewReader(bytes.NewReader(body), "lz4")
+	assert.Error(t, err)
+}
+
+func TestReadFile(t *testing.T) {
+	directory, err := ioutil.TempDir("", "reader")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	body := []byte(strings.Repeat("<html>hello</html>", 10))
+	digest := "00154761637ca746c354a6d9cfbf1da1a92e79afa6bb127bb8a1c434e9c73170"
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "plain.html"), body, 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "gzip.html.gz"), gzipped(t, body), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "zstd.html.zst"), zstded(t, body), 0644))
+
+	// content-addressed
+	assert.NoError(t, os.MkdirAll(filepath.Join(directory, objectsDirectory, "00"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, objectsDirectory, "00", digest+".zst"), zstded(t, body), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "object.html"+digestSuffix), []byte(digest), 0644))
+
+	for _, fileName := range []string{"plain.html", "gzip.html", "zstd.html", "object.html"} {
+		data, err := ReadFile(filepath.Join(directory, fileName))
+		assert.NoError(t, err, fileName)
+		assert.Equal(t, body, data, fileName)
+	}
+
+	// gzip body saved without compression is read as-is
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "raw.tar.gz"), gzipped(t, body), 0644))
+	data, err := ReadFile(filepath.Join(directory, "raw.tar.gz"))
+	assert.NoError(t, err)
+	assert.Equal(t, gzipped(t, body), data)
+
+	_, err = ReadFile(filepath.Join(directory, "notExist.html"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "invalid.html"+digestSuffix), []byte("../../etc/passwd"), 0644))
+	_, err = ReadFile(filepath.Join(directory, "invalid.html"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid SHA-256")
+}
+
+func TestReadFile_LongFileName(t *testing.T) {
+	directory, err := ioutil.TempDir("", "reader")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	body := []byte("<html>hello</html>")
+	digest := "00154761637ca746c354a6d9cfbf1da1a92e79afa6bb127bb8a1c434e9c73170"
+	long := strings.Repeat("a", 300)
+
+	// like escaped URLs of 300 bytes, saved by outputer with and without content-addressed store
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, FileName("gzip"+long, ".gz")), gzipped(t, body), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, FileName("plain"+long, "")), body, 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(directory, objectsDirectory, "00"), os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, objectsDirectory, "00", digest+".gz"), gzipped(t, body), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, FileName("object"+long, digestSuffix)), []byte(digest), 0644))
+
+	for _, fileName := range []string{"gzip" + long, "plain" + long, "object" + long} {
+		data, err := ReadFile(filepath.Join(directory, fileName))
+		assert.NoError(t, err, fileName)
+		assert.Equal(t, body, data, fileName)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	assert.Equal(t, "a.html.gz", FileName("a.html", ".gz"))
+
+	long := strings.Repeat("a", 300)
+	for _, suffix := range []string{"", ".gz", ".zst", digestSuffix} {
+		name := FileName(long, suffix)
+		assert.Len(t, name, fileNameMaxLength, suffix)
+		assert.True(t, strings.HasSuffix(name, suffix), suffix)
+		assert.True(t, strings.HasPrefix(name, long[:fileNameMaxLength-len(suffix)-md5HashLength]), suffix)
+	}
+}
+
+func TestSuffix(t *testing.T) {
+	assert.Equal(t, ".gz", Suffix("gzip"))
+	assert.Equal(t, ".zst", Suffix("zstd"))
+	assert.Equal(t, "", Suffix(""))
+}
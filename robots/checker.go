@@ -0,0 +1,122 @@
+// checker.go - check URLs against robots.txt of their hosts.
+
+package robots
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/baidu/go-lib/log"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+)
+
+type Fetcher interface {
+	// Fetch URL, give up when ctx is done.
+	Fetch(ctx context.Context, url string) (*fetcher.FetchResult, error)
+}
+
+const (
+	rulesTTL       = 24 * time.Hour  // time robots.txt fetched, or unavailable like 404, is cached
+	unreachableTTL = 5 * time.Minute // time robots.txt unreachable, like 5xx and network errors, is cached
+)
+
+// robots.txt of one host, fetched again once expired
+type hostRules struct {
+	lock    sync.Mutex
+	rules   *Rules
+	expires time.Time
+}
+
+type Checker struct {
+	userAgent string // user agent matched against robots.txt
+
+	cache sync.Map // scheme://host => *hostRules
+
+	fetcher Fetcher // fetcher for robots.txt
+
+	now func() time.Time // current time, replaced in UT
+}
+
+func NewChecker(cfg conf.RobotsConf, fetcher Fetcher) *Checker {
+	return &Checker{
+		userAgent: cfg.UserAgent,
+		fetcher:   fetcher,
+		now:       time.Now,
+	}
+}
+
+// Allowed checks whether u may be crawled, and gets Crawl-delay of u's host.
+// robots.txt of the host is fetched at the first call and cached for rulesTTL afterwards.
+// Hosts whose robots.txt is unavailable, like 404, are treated as allowing all,
+// and hosts whose robots.txt is unreachable, like 5xx and network errors, as disallowing all for unreachableTTL.
+func (c *Checker) Allowed(ctx context.Context, u *url.URL) (bool, time.Duration) {
+	rules := c.rulesOf(ctx, u)
+
+	return rules.Allowed(u.RequestURI()), rules.CrawlDelay()
+}
+
+// Get rules of u's host.
+func (c *Checker) rulesOf(ctx context.Context, u *url.URL) *Rules {
+	key := u.Scheme + "://" + u.Host
+
+	v, _ := c.cache.LoadOrStore(key, &hostRules{})
+	h := v.(*hostRules)
+
+	// fetched by one caller at a time
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := c.now()
+	if h.rules != nil && now.Before(h.expires) {
+		return h.rules
+	}
+
+	var ttl time.Duration
+	h.rules, ttl = c.fetchRules(ctx, key+"/robots.txt")
+	h.expires = now.Add(ttl)
+
+	return h.rules
+}
+
+// Fetch robots.txt of robotsURL, and get rules in it and time they are cached.
+func (c *Checker) fetchRules(ctx context.Context, robotsURL string) (*Rules, time.Duration) {
+	res, err := c.fetcher.Fetch(ctx, robotsURL)
+	if err == nil {
+		return Parse(res.Body).RulesFor(c.userAgent), rulesTTL
+	}
+
+	// given up by ctx, not cached
+	if ctx.Err() != nil {
+		log.Logger.Warn("fetchRules(): fetch %s cancelled, disallow all, fetcher.Fetch(): %v", robotsURL, err)
+		return disallowAll(), 0
+	}
+
+	if unreachable(err) {
+		log.Logger.Warn("fetchRules(): fetch %s failed, disallow all, fetcher.Fetch(): %v", robotsURL, err)
+		return disallowAll(), unreachableTTL
+	}
+
+	log.Logger.Warn("fetchRules(): fetch %s failed, allow all, fetcher.Fetch(): %v", robotsURL, err)
+
+	return &Rules{}, rulesTTL
+}
+
+// Check whether err of fetching robots.txt means the host is unreachable, like 5xx and network errors.
+func unreachable(err error) bool {
+	var statusErr *fetcher.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var timeoutErr *fetcher.TimeoutError
+	var dnsErr *fetcher.DNSError
+	var networkErr *fetcher.NetworkError
+
+	return errors.As(err, &timeoutErr) || errors.As(err, &dnsErr) || errors.As(err, &networkErr)
+}
@@ -0,0 +1,126 @@
+// checker_test.go - UT for checker.go.
+
+package robots
+
+import (
+	"context"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/conf"
+	"github.com/NKztq/spider/fetcher"
+)
+
+// implement for Fetcher
+type mockFetcher struct {
+	count int32            // times of Fetch
+	errs  map[string]error // URL => error returned
+}
+
+func (m *mockFetcher) Fetch(ctx context.Context, url string) (*fetcher.FetchResult, error) {
+	atomic.AddInt32(&m.count, 1)
+
+	if err, ok := m.errs[url]; ok {
+		return nil, err
+	}
+
+	if url == "http://www.baidu.com/robots.txt" {
+		body := []byte("User-agent: mini_spider\nDisallow: /private\nCrawl-delay: 3\n")
+		return &fetcher.FetchResult{URL: url, FinalURL: url, StatusCode: 200, Body: body}, nil
+	}
+
+	return nil, &fetcher.StatusError{URL: url, StatusCode: 404}
+}
+
+func TestAllowed(t *testing.T) {
+	fetcher := &mockFetcher{}
+	checker := NewChecker(conf.RobotsConf{Enable: true, UserAgent: "mini_spider"}, fetcher)
+
+	u, _ := url.Parse("http://www.baidu.com/private/a.html")
+	allowed, delay := checker.Allowed(context.Background(), u)
+	assert.False(t, allowed)
+	assert.Equal(t, 3*time.Second, delay)
+
+	u, _ = url.Parse("http://www.baidu.com/public/a.html?private")
+	allowed, delay = checker.Allowed(context.Background(), u)
+	assert.True(t, allowed)
+	assert.Equal(t, 3*time.Second, delay)
+
+	// robots.txt fetched only once for one host
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetcher.count))
+}
+
+func TestAllowed_FetchFailed(t *testing.T) {
+	fetcher := &mockFetcher{}
+	checker := NewChecker(conf.RobotsConf{Enable: true, UserAgent: "mini_spider"}, fetcher)
+
+	u, _ := url.Parse("http://www.sina.com.cn/private/a.html")
+	allowed, delay := checker.Allowed(context.Background(), u)
+	assert.True(t, allowed)
+	assert.Equal(t, time.Duration(0), delay)
+}
+
+func TestAllowed_Unreachable(t *testing.T) {
+	fetcher := &mockFetcher{errs: map[string]error{
+		"http://www.sina.com.cn/robots.txt": &fetcher.StatusError{URL: "http://www.sina.com.cn/robots.txt", StatusCode: 503},
+		"http://www.qq.com/robots.txt":      &fetcher.TimeoutError{URL: "http://www.qq.com/robots.txt"},
+	}}
+	checker := NewChecker(conf.RobotsConf{Enable: true, UserAgent: "mini_spider"}, fetcher)
+
+	// 5xx and network errors disallow all
+	for _, rawURL := range []string{"http://www.sina.com.cn/a.html", "http://www.qq.com/a.html"} {
+		u, _ := url.Parse(rawURL)
+		allowed, _ := checker.Allowed(context.Background(), u)
+		assert.False(t, allowed, rawURL)
+	}
+
+	// fetched again once expired
+	delete(fetcher.errs, "http://www.sina.com.cn/robots.txt")
+	u, _ := url.Parse("http://www.sina.com.cn/a.html")
+	allowed, _ := checker.Allowed(context.Background(), u)
+	assert.False(t, allowed)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetcher.count))
+
+	checker.now = func() time.Time { return time.Now().Add(unreachableTTL) }
+	allowed, _ = checker.Allowed(context.Background(), u)
+	assert.True(t, allowed)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&fetcher.count))
+}
+
+func TestAllowed_Expired(t *testing.T) {
+	fetcher := &mockFetcher{}
+	checker := NewChecker(conf.RobotsConf{Enable: true, UserAgent: "mini_spider"}, fetcher)
+
+	u, _ := url.Parse("http://www.baidu.com/private/a.html")
+	checker.Allowed(context.Background(), u)
+	checker.now = func() time.Time { return time.Now().Add(rulesTTL - time.Minute) }
+	checker.Allowed(context.Background(), u)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetcher.count))
+
+	checker.now = func() time.Time { return time.Now().Add(rulesTTL) }
+	allowed, _ := checker.Allowed(context.Background(), u)
+	assert.False(t, allowed)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetcher.count))
+}
+
+func TestAllowed_Cancelled(t *testing.T) {
+	fetcher := &mockFetcher{errs: map[string]error{"http://www.baidu.com/robots.txt": context.Canceled}}
+	checker := NewChecker(conf.RobotsConf{Enable: true, UserAgent: "mini_spider"}, fetcher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	u, _ := url.Parse("http://www.baidu.com/public/a.html")
+	allowed, _ := checker.Allowed(ctx, u)
+	assert.False(t, allowed)
+
+	// not cached
+	delete(fetcher.errs, "http://www.baidu.com/robots.txt")
+	allowed, _ = checker.Allowed(context.Background(), u)
+	assert.True(t, allowed)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetcher.count))
+}
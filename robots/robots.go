@@ -0,0 +1,206 @@
+// robots.go - parse robots.txt and match paths against its rules.
+
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a single Allow/Disallow line
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+// a group of rules shared by one or more user agents
+type group struct {
+	agents     []string // lower-cased user agent tokens
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// Robots is a parsed robots.txt.
+type Robots struct {
+	groups []*group
+}
+
+// Rules is the set of rules which applies to one user agent.
+type Rules struct {
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// Parse parses content of robots.txt.
+// Unknown or malformed lines are ignored.
+func Parse(content []byte) *Robots {
+	r := &Robots{}
+
+	var cur *group
+	inAgents := false // last meaningful line is User-agent
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// drop comment
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		val := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			// consecutive User-agent lines share one group
+			if !inAgents {
+				cur = &group{}
+				r.groups = append(r.groups, cur)
+			}
+			cur.agents = append(cur.agents, strings.ToLower(val))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			if cur == nil {
+				continue
+			}
+			// empty Disallow means allow all, which equals no rule
+			if val == "" {
+				continue
+			}
+			cur.rules = append(cur.rules, rule{key == "allow", val})
+		case "crawl-delay":
+			inAgents = false
+			if cur == nil {
+				continue
+			}
+			seconds, err := strconv.ParseFloat(val, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			cur.crawlDelay = time.Duration(seconds * float64(time.Second))
+		default:
+			// other lines(e.g. Sitemap) do not end a User-agent run
+		}
+	}
+
+	return r
+}
+
+// RulesFor gets rules for userAgent.
+// The group whose agent token is the longest one contained in userAgent wins,
+// "*" is used if no group matches.
+func (r *Robots) RulesFor(userAgent string) *Rules {
+	userAgent = strings.ToLower(userAgent)
+
+	var matched *group
+	var wildcard *group
+	matchedLen := 0
+
+	for _, g := range r.groups {
+		for _, agent := range g.agents {
+			if agent == "*" {
+				if wildcard == nil {
+					wildcard = g
+				}
+				continue
+			}
+
+			if agent != "" && strings.Contains(userAgent, agent) && len(agent) > matchedLen {
+				matched = g
+				matchedLen = len(agent)
+			}
+		}
+	}
+
+	if matched == nil {
+		matched = wildcard
+	}
+
+	if matched == nil {
+		return &Rules{}
+	}
+
+	return &Rules{matched.rules, matched.crawlDelay}
+}
+
+// Get rules disallowing all paths.
+func disallowAll() *Rules {
+	return &Rules{rules: []rule{{false, "/"}}}
+}
+
+// Allowed checks whether path(with query) may be crawled.
+// The longest matching rule wins, Allow wins if lengths are equal.
+func (r *Rules) Allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+
+	allowed := true
+	matchedLen := -1
+
+	for _, ru := range r.rules {
+		if !match(ru.pattern, path) {
+			continue
+		}
+
+		l := len(ru.pattern)
+		if l > matchedLen || (l == matchedLen && ru.allow) {
+			allowed = ru.allow
+			matchedLen = l
+		}
+	}
+
+	return allowed
+}
+
+// CrawlDelay gets Crawl-delay, zero if not set.
+func (r *Rules) CrawlDelay() time.Duration {
+	return r.crawlDelay
+}
+
+// Match path against pattern, which supports "*" for any sequence
+// and a trailing "$" for end of path.
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+
+	// first part must be a prefix
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+
+		// last part of an anchored pattern must be a suffix
+		if anchored && i == len(parts)-1 {
+			return len(path)-pos >= len(part) && strings.HasSuffix(path, part)
+		}
+
+		j := strings.Index(path[pos:], part)
+		if j < 0 {
+			return false
+		}
+		pos += j + len(part)
+	}
+
+	if anchored {
+		return pos == len(path)
+	}
+
+	return true
+}
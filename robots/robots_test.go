@@ -0,0 +1,83 @@
+// robots_test.go - UT for robots.go.
+
+package robots
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse_Wildcard(t *testing.T) {
+	content, err := ioutil.ReadFile("./testdata/robots.txt")
+	assert.NoError(t, err)
+
+	rules := Parse(content).RulesFor("unknown_spider")
+
+	assert.True(t, rules.Allowed("/"))
+	assert.True(t, rules.Allowed("/index.html"))
+	assert.False(t, rules.Allowed("/private/"))
+	assert.False(t, rules.Allowed("/private/secret.html"))
+	assert.True(t, rules.Allowed("/private/public.html"))
+	assert.False(t, rules.Allowed("/a/b.php"))
+	assert.True(t, rules.Allowed("/a/b.php?x=1"))
+	assert.Equal(t, 2*time.Second, rules.CrawlDelay())
+}
+
+func TestParse_MatchedUserAgent(t *testing.T) {
+	content, err := ioutil.ReadFile("./testdata/robots.txt")
+	assert.NoError(t, err)
+
+	r := Parse(content)
+
+	// consecutive User-agent lines share one group, matching is case-insensitive
+	for _, ua := range []string{"mini_spider", "Mozilla/5.0 (compatible; Mini_Spider/1.0)", "other_spider"} {
+		rules := r.RulesFor(ua)
+		assert.False(t, rules.Allowed("/tmp/a.html"), ua)
+		assert.True(t, rules.Allowed("/tmp/ok.html"), ua)
+		assert.True(t, rules.Allowed("/private/"), ua)
+		assert.Equal(t, 500*time.Millisecond, rules.CrawlDelay(), ua)
+	}
+
+	// group after Sitemap line
+	assert.False(t, r.RulesFor("BadBot").Allowed("/index.html"))
+}
+
+func TestParse_Empty(t *testing.T) {
+	rules := Parse([]byte("")).RulesFor("mini_spider")
+
+	assert.True(t, rules.Allowed("/"))
+	assert.Equal(t, time.Duration(0), rules.CrawlDelay())
+}
+
+func TestParse_EmptyDisallow(t *testing.T) {
+	rules := Parse([]byte("User-agent: *\nDisallow:\n")).RulesFor("mini_spider")
+
+	assert.True(t, rules.Allowed("/index.html"))
+}
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		expect  bool
+	}{
+		{"/", "/a", true},
+		{"/a", "/abc", true},
+		{"/a", "/b", false},
+		{"/a*c", "/abc", true},
+		{"/a*c", "/ab", false},
+		{"/a*c$", "/abcd", false},
+		{"/a*c$", "/abc", true},
+		{"/a$", "/a", true},
+		{"/a$", "/ab", false},
+		{"/*.html$", "/x/y.html", true},
+		{"/*.html$", "/x/y.html?a=1", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expect, match(c.pattern, c.path), "%s %s", c.pattern, c.path)
+	}
+}
@@ -0,0 +1,147 @@
+// scope.go - decide whether a URL is in crawl scope.
+
+package scope
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/NKztq/spider/conf"
+)
+
+var (
+	defaultSchemes = []string{"http", "https"} // schemes allowed if none is configured
+)
+
+type Scope struct {
+	allowedHosts []string // host suffixes allowed, all hosts allowed if empty
+	deniedHosts  []string // host suffixes denied
+
+	includeURLs []*regexp.Regexp // URL should match one of them if not empty
+	excludeURLs []*regexp.Regexp // URL should match none of them
+
+	schemes map[string]bool // schemes allowed
+
+	seedHosts map[string]bool // hosts of seeds, nil if not limited to them
+}
+
+// NewScope creates scope by config, seeds are used for SameHostAsSeed.
+func NewScope(cfg conf.ScopeConf, seeds []string) (*Scope, error) {
+	s := &Scope{
+		allowedHosts: lowerAll(cfg.AllowedHost),
+		deniedHosts:  lowerAll(cfg.DeniedHost),
+		schemes:      make(map[string]bool),
+	}
+
+	var err error
+
+	s.includeURLs, err = compileAll(cfg.IncludeURL)
+	if err != nil {
+		return nil, err
+	}
+
+	s.excludeURLs, err = compileAll(cfg.ExcludeURL)
+	if err != nil {
+		return nil, err
+	}
+
+	schemes := cfg.AllowedScheme
+	if len(schemes) == 0 {
+		schemes = defaultSchemes
+	}
+	for _, scheme := range schemes {
+		s.schemes[strings.ToLower(scheme)] = true
+	}
+
+	if cfg.SameHostAsSeed {
+		s.seedHosts = make(map[string]bool)
+		for _, seed := range seeds {
+			u, err := url.Parse(seed)
+			if err != nil {
+				continue
+			}
+			s.seedHosts[strings.ToLower(u.Hostname())] = true
+		}
+	}
+
+	return s, nil
+}
+
+// InScope checks whether u should be crawled.
+func (s *Scope) InScope(u *url.URL) bool {
+	if !s.schemes[strings.ToLower(u.Scheme)] {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+
+	if s.seedHosts != nil && !s.seedHosts[host] {
+		return false
+	}
+
+	if matchSuffix(host, s.deniedHosts) {
+		return false
+	}
+
+	if len(s.allowedHosts) > 0 && !matchSuffix(host, s.allowedHosts) {
+		return false
+	}
+
+	uStr := u.String()
+
+	if len(s.includeURLs) > 0 && !matchAny(uStr, s.includeURLs) {
+		return false
+	}
+
+	if matchAny(uStr, s.excludeURLs) {
+		return false
+	}
+
+	return true
+}
+
+// Check whether host is one of suffixes or a subdomain of them.
+func matchSuffix(host string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check whether s matches one of patterns.
+func matchAny(s string, patterns []*regexp.Regexp) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern: %s, regexp.Compile(): %v", pattern, err)
+		}
+		compiled = append(compiled, r)
+	}
+
+	return compiled, nil
+}
+
+func lowerAll(strs []string) []string {
+	lowered := []string{}
+	for _, s := range strs {
+		lowered = append(lowered, strings.ToLower(strings.TrimPrefix(s, ".")))
+	}
+
+	return lowered
+}
@@ -0,0 +1,87 @@
+// scope_test.go - UT for scope.go.
+
+package scope
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/conf"
+)
+
+func inScope(t *testing.T, s *Scope, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	assert.NoError(t, err)
+
+	return s.InScope(u)
+}
+
+func TestInScope_Default(t *testing.T) {
+	s, err := NewScope(conf.ScopeConf{}, nil)
+	assert.NoError(t, err)
+
+	assert.True(t, inScope(t, s, "http://www.baidu.com"))
+	assert.True(t, inScope(t, s, "HTTPS://www.sina.com.cn/a.html"))
+	assert.False(t, inScope(t, s, "mailto:someone@baidu.com"))
+	assert.False(t, inScope(t, s, "javascript:void(0)"))
+	assert.False(t, inScope(t, s, "ftp://ftp.baidu.com/a"))
+}
+
+func TestInScope_Host(t *testing.T) {
+	cfg := conf.ScopeConf{
+		AllowedHost: []string{"baidu.com", ".SINA.com.cn"},
+		DeniedHost:  []string{"passport.baidu.com"},
+	}
+
+	s, err := NewScope(cfg, nil)
+	assert.NoError(t, err)
+
+	assert.True(t, inScope(t, s, "http://baidu.com"))
+	assert.True(t, inScope(t, s, "http://www.baidu.com:8080/a"))
+	assert.True(t, inScope(t, s, "http://news.sina.com.cn"))
+	assert.False(t, inScope(t, s, "http://notbaidu.com"))
+	assert.False(t, inScope(t, s, "http://passport.baidu.com/login"))
+	assert.False(t, inScope(t, s, "http://a.passport.baidu.com/login"))
+	assert.False(t, inScope(t, s, "http://www.google.com"))
+}
+
+func TestInScope_URLPattern(t *testing.T) {
+	cfg := conf.ScopeConf{
+		IncludeURL: []string{"/news/", "/sports/"},
+		ExcludeURL: []string{"\\.(jpg|png)$"},
+	}
+
+	s, err := NewScope(cfg, nil)
+	assert.NoError(t, err)
+
+	assert.True(t, inScope(t, s, "http://www.baidu.com/news/1.html"))
+	assert.True(t, inScope(t, s, "http://www.baidu.com/sports/1.html"))
+	assert.False(t, inScope(t, s, "http://www.baidu.com/music/1.html"))
+	assert.False(t, inScope(t, s, "http://www.baidu.com/news/1.jpg"))
+}
+
+func TestInScope_Scheme(t *testing.T) {
+	s, err := NewScope(conf.ScopeConf{AllowedScheme: []string{"HTTPS"}}, nil)
+	assert.NoError(t, err)
+
+	assert.True(t, inScope(t, s, "https://www.baidu.com"))
+	assert.False(t, inScope(t, s, "http://www.baidu.com"))
+}
+
+func TestInScope_SameHostAsSeed(t *testing.T) {
+	seeds := []string{"http://www.baidu.com", "http://WWW.SINA.com.cn:8080/index.html"}
+
+	s, err := NewScope(conf.ScopeConf{SameHostAsSeed: true}, seeds)
+	assert.NoError(t, err)
+
+	assert.True(t, inScope(t, s, "http://www.baidu.com/a.html"))
+	assert.True(t, inScope(t, s, "https://www.sina.com.cn/a.html"))
+	assert.False(t, inScope(t, s, "http://news.baidu.com/a.html"))
+}
+
+func TestNewScope_InvalidPattern(t *testing.T) {
+	_, err := NewScope(conf.ScopeConf{ExcludeURL: []string{"(jpg"}}, nil)
+	assert.Error(t, err)
+}
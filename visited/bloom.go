@@ -0,0 +1,161 @@
+// bloom.go - visited set by scalable bloom filter.
+
+package visited
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+const (
+	bloomGrowth    = 2   // capacity of each new filter is bloomGrowth times of the last one
+	bloomTightenFP = 0.5 // false positive rate of each new filter is bloomTightenFP times of the last one
+)
+
+// bloom filter of fixed capacity
+type bloomFilter struct {
+	bits     []uint64
+	m        uint64  // count of bits
+	k        uint64  // count of hash functions
+	capacity int     // count of keys the filter is designed for
+	fpRate   float64 // false positive rate the filter is designed for
+	count    int     // count of keys added
+}
+
+func newBloomFilter(capacity int, fpRate float64) *bloomFilter {
+	// m = -n*ln(p)/(ln2)^2, k = m/n*ln2
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+
+	k := uint64(math.Round(float64(m) / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &bloomFilter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		capacity: capacity,
+		fpRate:   fpRate,
+	}
+}
+
+// Check whether key may be in filter, h1 and h2 are hashes of key.
+func (f *bloomFilter) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Add key to filter, h1 and h2 are hashes of key.
+func (f *bloomFilter) add(h1, h2 uint64) {
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+
+	f.count++
+}
+
+// BloomSet is a scalable bloom filter, which adds a larger and tighter filter when the last one is full,
+// so that its false positive rate stays under the configured one however many keys are added.
+// Add may return false for a key not in set with that rate, it never returns true for a key in set.
+type BloomSet struct {
+	initialCapacity int
+	fpRate          float64
+
+	lock    sync.Mutex
+	filters []*bloomFilter
+	count   int
+}
+
+// NewBloomSet creates bloom set, capacity is count of keys of the first filter,
+// fpRate is the upper bound of false positive rate.
+func NewBloomSet(capacity int, fpRate float64) *BloomSet {
+	s := &BloomSet{
+		initialCapacity: capacity,
+		fpRate:          fpRate,
+	}
+	s.init()
+
+	return s
+}
+
+// Reset filters to the first one.
+func (s *BloomSet) init() {
+	// sum of fpRate*(1-r)*r^i is fpRate
+	s.filters = []*bloomFilter{newBloomFilter(s.initialCapacity, s.fpRate*(1-bloomTightenFP))}
+	s.count = 0
+}
+
+// Add key to set, returns false if key is in set already, or is a false positive.
+func (s *BloomSet) Add(key string) (bool, error) {
+	h1, h2 := bloomHash(key)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, f := range s.filters {
+		if f.test(h1, h2) {
+			return false, nil
+		}
+	}
+
+	last := s.filters[len(s.filters)-1]
+	if last.count >= last.capacity {
+		last = newBloomFilter(last.capacity*bloomGrowth, last.fpRate*bloomTightenFP)
+		s.filters = append(s.filters, last)
+	}
+
+	last.add(h1, h2)
+	s.count++
+
+	return true, nil
+}
+
+// Len gets count of keys added.
+func (s *BloomSet) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.count
+}
+
+// Reset drops all keys in set.
+func (s *BloomSet) Reset() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.init()
+
+	return nil
+}
+
+// Close releases resources of set.
+func (s *BloomSet) Close() error {
+	return nil
+}
+
+// Get two hashes of key for double hashing.
+func bloomHash(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+
+	// splitmix64 finalizer of h1 as the second hash, odd so that it walks all bits
+	h2 := h1 + 0x9e3779b97f4a7c15
+	h2 = (h2 ^ (h2 >> 30)) * 0xbf58476d1ce4e5b9
+	h2 = (h2 ^ (h2 >> 27)) * 0x94d049bb133111eb
+	h2 = h2 ^ (h2 >> 31)
+
+	return h1, h2 | 1
+}
@@ -0,0 +1,50 @@
+// bloom_test.go - UT for bloom.go.
+
+package visited
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloomSet_FalsePositiveRate(t *testing.T) {
+	fpRate := 0.01
+
+	// scale from 100 keys to 10000 keys
+	s := NewBloomSet(100, fpRate)
+	for i := 0; i < 10000; i++ {
+		_, err := s.Add(fmt.Sprintf("http://www.baidu.com/%d", i))
+		assert.NoError(t, err)
+	}
+	assert.True(t, len(s.filters) > 1)
+
+	// keys never added are false positive if Add returns false
+	falsePositive := 0
+	total := 10000
+	for i := 0; i < total; i++ {
+		added, err := s.Add(fmt.Sprintf("http://www.sina.com.cn/%d", i))
+		assert.NoError(t, err)
+		if !added {
+			falsePositive++
+		}
+	}
+
+	assert.True(t, float64(falsePositive)/float64(total) < fpRate, "false positive: %d", falsePositive)
+}
+
+func TestBloomSet_NoFalseNegative(t *testing.T) {
+	s := NewBloomSet(10, 0.001)
+
+	for i := 0; i < 1000; i++ {
+		_, err := s.Add(fmt.Sprintf("http://www.baidu.com/%d", i))
+		assert.NoError(t, err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		added, err := s.Add(fmt.Sprintf("http://www.baidu.com/%d", i))
+		assert.NoError(t, err)
+		assert.False(t, added)
+	}
+}
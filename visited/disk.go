@@ -0,0 +1,151 @@
+// disk.go - visited set on disk.
+
+package visited
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path"
+	"sync"
+)
+
+const (
+	diskSetFileName = "visited.data"
+
+	// a record is: offset of previous record with the same hash(8 bytes) + length of key(4 bytes) + key
+	recordHeaderLength = 12
+	noRecord           = -1
+)
+
+// DiskSet keeps keys in an append-only file, and only hashes of keys with offsets in memory.
+// Records with the same hash are chained in file, so the set is exact.
+type DiskSet struct {
+	filePath string
+
+	lock   sync.Mutex
+	file   *os.File
+	size   int64            // size of file
+	count  int              // count of keys
+	index  map[uint64]int64 // hash of key => offset of the last record with the hash
+	header []byte           // buffer for reading record header
+}
+
+// NewDiskSet creates disk set in directory, keys left by last run are dropped.
+func NewDiskSet(directory string) (*DiskSet, error) {
+	err := os.MkdirAll(directory, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("directory: %s, os.MkdirAll(): %v", directory, err)
+	}
+
+	filePath := path.Join(directory, diskSetFileName)
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(): %s, err: %v", filePath, err)
+	}
+
+	return &DiskSet{
+		filePath: filePath,
+		file:     file,
+		index:    make(map[uint64]int64),
+		header:   make([]byte, recordHeaderLength),
+	}, nil
+}
+
+// Add key to set, returns false if key is in set already.
+func (s *DiskSet) Add(key string) (bool, error) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	hash := h.Sum64()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	prev, ok := s.index[hash]
+	if !ok {
+		prev = noRecord
+	}
+
+	// walk records with the same hash
+	for offset := prev; offset != noRecord; {
+		k, next, err := s.readRecord(offset)
+		if err != nil {
+			return false, err
+		}
+
+		if k == key {
+			return false, nil
+		}
+
+		offset = next
+	}
+
+	record := make([]byte, recordHeaderLength+len(key))
+	binary.BigEndian.PutUint64(record, uint64(prev))
+	binary.BigEndian.PutUint32(record[8:], uint32(len(key)))
+	copy(record[recordHeaderLength:], key)
+
+	_, err := s.file.WriteAt(record, s.size)
+	if err != nil {
+		return false, fmt.Errorf("write to file: %s failed, err: %v", s.filePath, err)
+	}
+
+	s.index[hash] = s.size
+	s.size += int64(len(record))
+	s.count++
+
+	return true, nil
+}
+
+// Read key of record at offset, and offset of previous record with the same hash.
+func (s *DiskSet) readRecord(offset int64) (string, int64, error) {
+	_, err := s.file.ReadAt(s.header, offset)
+	if err != nil {
+		return "", noRecord, fmt.Errorf("read file: %s failed, err: %v", s.filePath, err)
+	}
+
+	prev := int64(binary.BigEndian.Uint64(s.header))
+	key := make([]byte, binary.BigEndian.Uint32(s.header[8:]))
+
+	_, err = s.file.ReadAt(key, offset+recordHeaderLength)
+	if err != nil {
+		return "", noRecord, fmt.Errorf("read file: %s failed, err: %v", s.filePath, err)
+	}
+
+	return string(key), prev, nil
+}
+
+// Len gets count of keys in set.
+func (s *DiskSet) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.count
+}
+
+// Reset drops all keys in set.
+func (s *DiskSet) Reset() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := s.file.Truncate(0)
+	if err != nil {
+		return fmt.Errorf("truncate file: %s failed, err: %v", s.filePath, err)
+	}
+
+	s.size = 0
+	s.count = 0
+	s.index = make(map[uint64]int64)
+
+	return nil
+}
+
+// Close releases resources of set.
+func (s *DiskSet) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.file.Close()
+}
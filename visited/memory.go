@@ -0,0 +1,49 @@
+// memory.go - visited set in memory.
+
+package visited
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type MemorySet struct {
+	keys  sync.Map
+	count int64
+}
+
+func NewMemorySet() *MemorySet {
+	return &MemorySet{}
+}
+
+// Add key to set, returns false if key is in set already.
+func (s *MemorySet) Add(key string) (bool, error) {
+	if _, exist := s.keys.LoadOrStore(key, true); exist {
+		return false, nil
+	}
+
+	atomic.AddInt64(&s.count, 1)
+
+	return true, nil
+}
+
+// Len gets count of keys in set.
+func (s *MemorySet) Len() int {
+	return int(atomic.LoadInt64(&s.count))
+}
+
+// Reset drops all keys in set.
+func (s *MemorySet) Reset() error {
+	s.keys.Range(func(key, value interface{}) bool {
+		s.keys.Delete(key)
+		atomic.AddInt64(&s.count, -1)
+		return true
+	})
+
+	return nil
+}
+
+// Close releases resources of set.
+func (s *MemorySet) Close() error {
+	return nil
+}
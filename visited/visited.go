@@ -0,0 +1,44 @@
+// visited.go - set of visited URLs.
+
+package visited
+
+import (
+	"fmt"
+
+	"github.com/NKztq/spider/conf"
+)
+
+const (
+	TypeMemory = "memory" // exact, all keys in memory
+	TypeBloom  = "bloom"  // approximate, scalable bloom filter in memory
+	TypeDisk   = "disk"   // exact, keys on disk and their hashes in memory
+)
+
+// Set is a set of visited URLs, safe for concurrent use.
+type Set interface {
+	// Add key to set, returns false if key is in set already.
+	Add(key string) (bool, error)
+
+	// Len gets count of keys in set.
+	Len() int
+
+	// Reset drops all keys in set.
+	Reset() error
+
+	// Close releases resources of set.
+	Close() error
+}
+
+// NewSet creates visited set by cfg.VisitedSet, memory set is used if it is empty.
+func NewSet(cfg conf.CrawlerConf) (Set, error) {
+	switch cfg.VisitedSet {
+	case "", TypeMemory:
+		return NewMemorySet(), nil
+	case TypeBloom:
+		return NewBloomSet(cfg.BloomCapacity, cfg.BloomFalsePositiveRate), nil
+	case TypeDisk:
+		return NewDiskSet(cfg.VisitedSetDirectory)
+	default:
+		return nil, fmt.Errorf("unknown visited set: %s", cfg.VisitedSet)
+	}
+}
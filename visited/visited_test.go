@@ -0,0 +1,169 @@
+// visited_test.go - UT and benchmark for visited sets.
+
+package visited
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NKztq/spider/conf"
+)
+
+func newSets(t testing.TB, directory string) map[string]Set {
+	disk, err := NewDiskSet(directory)
+	assert.NoError(t, err)
+
+	return map[string]Set{
+		TypeMemory: NewMemorySet(),
+		TypeBloom:  NewBloomSet(1000, 0.001),
+		TypeDisk:   disk,
+	}
+}
+
+func TestSet(t *testing.T) {
+	directory := "./test_visited"
+	defer func() {
+		// remove UT output
+		assert.NoError(t, os.RemoveAll(directory))
+	}()
+
+	for name, s := range newSets(t, directory) {
+		added, err := s.Add("http://www.baidu.com")
+		assert.NoError(t, err)
+		assert.True(t, added, name)
+
+		added, err = s.Add("http://www.baidu.com")
+		assert.NoError(t, err)
+		assert.False(t, added, name)
+
+		added, err = s.Add("http://www.baidu1.com")
+		assert.NoError(t, err)
+		assert.True(t, added, name)
+
+		assert.Equal(t, 2, s.Len(), name)
+
+		assert.NoError(t, s.Reset())
+		assert.Equal(t, 0, s.Len(), name)
+
+		added, err = s.Add("http://www.baidu.com")
+		assert.NoError(t, err)
+		assert.True(t, added, name)
+
+		assert.NoError(t, s.Close())
+	}
+}
+
+func TestSet_Concurrent(t *testing.T) {
+	directory := "./test_visited1"
+	defer func() {
+		// remove UT output
+		assert.NoError(t, os.RemoveAll(directory))
+	}()
+
+	for name, s := range newSets(t, directory) {
+		var wg sync.WaitGroup
+		var lock sync.Mutex
+		added := 0
+
+		// every key is added by 4 goroutines, only one of them succeeds
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 500; j++ {
+					ok, err := s.Add(fmt.Sprintf("http://www.baidu.com/%d", j))
+					assert.NoError(t, err)
+					if ok {
+						lock.Lock()
+						added++
+						lock.Unlock()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 500, added, name)
+		assert.Equal(t, 500, s.Len(), name)
+		assert.NoError(t, s.Close())
+	}
+}
+
+func TestNewSet(t *testing.T) {
+	directory := "./test_visited2"
+	defer func() {
+		// remove UT output
+		assert.NoError(t, os.RemoveAll(directory))
+	}()
+
+	s, err := NewSet(conf.CrawlerConf{})
+	assert.NoError(t, err)
+	assert.IsType(t, &MemorySet{}, s)
+
+	s, err = NewSet(conf.CrawlerConf{VisitedSet: TypeBloom, BloomCapacity: 10, BloomFalsePositiveRate: 0.01})
+	assert.NoError(t, err)
+	assert.IsType(t, &BloomSet{}, s)
+
+	s, err = NewSet(conf.CrawlerConf{VisitedSet: TypeDisk, VisitedSetDirectory: directory})
+	assert.NoError(t, err)
+	assert.IsType(t, &DiskSet{}, s)
+	assert.NoError(t, s.Close())
+
+	_, err = NewSet(conf.CrawlerConf{VisitedSet: "redis"})
+	assert.True(t, strings.Contains(err.Error(), "unknown visited set: redis"))
+}
+
+// Benchmark throughput of Add, and memory per key by "heapB/key".
+func BenchmarkSet(b *testing.B) {
+	directory := "./test_visited_bench"
+	defer os.RemoveAll(directory)
+
+	for _, name := range []string{TypeMemory, TypeBloom, TypeDisk} {
+		b.Run(name, func(b *testing.B) {
+			var s Set
+			var err error
+			switch name {
+			case TypeMemory:
+				s = NewMemorySet()
+			case TypeBloom:
+				s = NewBloomSet(100000, 0.001)
+			case TypeDisk:
+				s, err = NewDiskSet(directory)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			defer s.Close()
+
+			// keys are prepared before measuring
+			keys := make([]string, b.N)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("http://www.baidu.com/path/to/some/page/%d.html?from=bench", i)
+			}
+
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			b.ResetTimer()
+			for _, key := range keys {
+				if _, err := s.Add(key); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "heapB/key")
+
+			runtime.KeepAlive(keys)
+		})
+	}
+}